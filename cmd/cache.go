@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// runCache inspects and invalidates the cache of Spotify search results:
+//
+//	cache list [-format text|json]  list every cached match
+//	cache delete <isrc or id>...    remove the matches for the given songs
+//	cache prune                     remove the matches that are no longer fresh
+//	cache clear                     remove every match
+func runCache(cache store.MatchCache, args []string) {
+	if len(args) == 0 {
+		timber.FatalMsg("missing cache command (list, delete, prune, or clear)")
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "list":
+		var (
+			flags  = flag.NewFlagSet("cache list", flag.ExitOnError)
+			format = flags.String("format", "text", "output format (text or json)")
+		)
+		_ = flags.Parse(args)
+		matches, err := cache.File.Load()
+		if err != nil {
+			timber.Fatal(err, "failed to load match cache")
+		}
+		switch *format {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(matches)
+			if err != nil {
+				timber.Fatal(err, "failed to write match cache")
+			}
+		case "text":
+			writeMatchesText(cache, matches)
+		default:
+			timber.FatalMsg("unknown cache list format", *format)
+		}
+	case "delete":
+		if len(args) == 0 {
+			timber.FatalMsg("missing isrcs or apple music ids of the songs to delete")
+		}
+		removed := updateCache(cache, func(key string, _ store.CachedMatch) bool {
+			_, id, _ := strings.Cut(key, ":")
+			return slices.Contains(args, key) || slices.Contains(args, id)
+		})
+		timber.Done("Deleted", removed, "songs from the match cache")
+	case "prune":
+		now := time.Now()
+		removed := updateCache(cache, func(_ string, match store.CachedMatch) bool {
+			return !cache.Fresh(match, now)
+		})
+		timber.Done("Pruned", removed, "expired songs from the match cache")
+	case "clear":
+		removed := updateCache(cache, func(string, store.CachedMatch) bool { return true })
+		timber.Done("Cleared", removed, "songs from the match cache")
+	default:
+		timber.FatalMsg("unknown cache command", command)
+	}
+}
+
+// updateCache removes every match that remove returns true for and returns how many were removed.
+func updateCache(cache store.MatchCache, remove func(string, store.CachedMatch) bool) int {
+	removed := 0
+	err := cache.File.Update(func(matches *store.Matches) error {
+		for key, match := range *matches {
+			if remove(key, match) {
+				delete(*matches, key)
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		timber.Fatal(err, "failed to update match cache")
+	}
+	return removed
+}
+
+func writeMatchesText(cache store.MatchCache, matches store.Matches) {
+	now := time.Now()
+	for _, key := range slices.Sorted(maps.Keys(matches)) {
+		var (
+			cached = matches[key]
+			match  = cached.Match
+			status = "fresh"
+		)
+		if !cache.Fresh(cached, now) {
+			status = "expired"
+		}
+		if match.Found {
+			fmt.Printf(
+				"%s \"%s\" by \"%s\" -> %s (%s, cached %s, %s)\n",
+				key,
+				match.Source.Name,
+				match.Source.Artist,
+				match.Song.ID,
+				match.Reason,
+				cached.CachedAt.Format(time.DateTime),
+				status,
+			)
+			continue
+		}
+		fmt.Printf(
+			"%s \"%s\" by \"%s\" not found (%s, cached %s, %s)\n",
+			key,
+			match.Source.Name,
+			match.Source.Artist,
+			match.Reason,
+			cached.CachedAt.Format(time.DateTime),
+			status,
+		)
+	}
+}
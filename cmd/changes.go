@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/overrides"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+// versions identifies the current versions of both sides of a playlist so a sync can be skipped
+// when nothing changed since the last one.
+type versions struct {
+	snapshotID        string
+	appleMusicVersion string
+	settings          string
+}
+
+// currentVersions fetches the Spotify snapshot ID and the Apple Music last modified date of the
+// playlist. If Apple Music doesn't include a last modified date a hash of the IDs of the songs in
+// the playlist is used instead, which still skips looking up the songs and searching for them.
+func (s *syncer) currentVersions(
+	ctx context.Context,
+	playlist playlists.Playlist,
+) (versions, error) {
+	snapshotID, err := spotify.PlaylistSnapshot(ctx, s.spotifyClient, playlist.SpotifyID)
+	if err != nil {
+		return versions{}, fmt.Errorf("%w failed to get snapshot id for playlist", err)
+	}
+
+	appleMusicVersion, err := applemusic.PlaylistLastModified(
+		ctx,
+		s.appleMusicClient,
+		playlist.AppleMusicID,
+	)
+	if err != nil {
+		return versions{}, err
+	}
+	if appleMusicVersion == "" {
+		ids, err := applemusic.PlaylistSongs(ctx, s.appleMusicClient, playlist.AppleMusicID)
+		if err != nil {
+			return versions{}, fmt.Errorf("%w failed to get apple music playlist", err)
+		}
+		appleMusicVersion = "songs:" + hash(strings.Join(ids, ","))
+	}
+
+	settings, err := s.settings(playlist)
+	if err != nil {
+		return versions{}, err
+	}
+	return versions{
+		snapshotID:        snapshotID,
+		appleMusicVersion: appleMusicVersion,
+		settings:          settings,
+	}, nil
+}
+
+// settings fingerprints everything besides the songs themselves that changes what a sync does.
+// The schedule of the playlist is left out since it doesn't.
+func (s *syncer) settings(playlist playlists.Playlist) (string, error) {
+	songOverrides, err := overrides.Load(s.overridesPath)
+	if err != nil {
+		return "", fmt.Errorf("%w failed to load overrides", err)
+	}
+	playlist.Interval = 0
+	playlist.Cron = ""
+	binary, err := json.Marshal(struct {
+		Playlist  playlists.Playlist
+		Overrides overrides.Overrides
+	}{Playlist: playlist, Overrides: songOverrides})
+	if err != nil {
+		return "", fmt.Errorf("%w failed to json marshal settings", err)
+	}
+	return hash(string(binary)), nil
+}
+
+// unchanged reports if the playlist can be skipped because neither side nor its settings changed
+// since the last sync and every song that wasn't found on Spotify then would be skipped by the
+// match cache instead of being searched for again.
+func (s *syncer) unchanged(playlist playlists.Playlist, current versions) (bool, error) {
+	state, err := s.stateFile.Load()
+	if err != nil {
+		return false, fmt.Errorf("%w failed to load sync state", err)
+	}
+	previous, ok := state[playlist.AppleMusicID]
+	if !ok || previous.SnapshotID != current.snapshotID ||
+		previous.AppleMusicVersion != current.appleMusicVersion ||
+		previous.Settings != current.settings {
+		return false, nil
+	}
+
+	unmatched, err := s.unmatchedFile.Load()
+	if err != nil {
+		return false, fmt.Errorf("%w failed to load unmatched songs", err)
+	}
+	songs := unmatched[playlist.AppleMusicID].Songs
+	if len(songs) == 0 {
+		return true, nil
+	}
+	if s.executor.Cache == nil {
+		return false, nil
+	}
+
+	// songs that weren't found are searched for again once their negative cache entry expires
+	cached, err := s.executor.Cache.File.Load()
+	if err != nil {
+		return false, fmt.Errorf("%w failed to load match cache", err)
+	}
+	now := time.Now()
+	for key := range songs {
+		match, ok := cached[key]
+		if !ok || match.Match.Found || !s.executor.Cache.Fresh(match, now) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (v versions) apply(state *store.PlaylistState) {
+	state.SnapshotID = v.snapshotID
+	state.AppleMusicVersion = v.appleMusicVersion
+	state.Settings = v.settings
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+func TestUnchanged(t *testing.T) {
+	var (
+		playlist = playlists.Playlist{Name: "one", AppleMusicID: "p.one", SpotifyID: "spotify"}
+		current  = versions{snapshotID: "snapshot", appleMusicVersion: "version", settings: "settings"}
+		now      = time.Now()
+		missing  = store.UnmatchedSong{Name: "Missing", Artist: "Artist", ISRC: "MISSING"}
+	)
+
+	tests := []struct {
+		name      string
+		snapshot  string
+		unmatched map[string]store.UnmatchedSong
+		cache     store.Matches
+		noCache   bool
+		want      bool
+	}{
+		{name: "no unmatched songs", want: true},
+		{name: "spotify changed", snapshot: "changed", want: false},
+		{
+			name:      "fresh negative cache entry",
+			unmatched: map[string]store.UnmatchedSong{"isrc:MISSING": missing},
+			cache:     store.Matches{"isrc:MISSING": {CachedAt: now.Add(-time.Hour)}},
+			want:      true,
+		},
+		{
+			name:      "expired negative cache entry",
+			unmatched: map[string]store.UnmatchedSong{"isrc:MISSING": missing},
+			cache:     store.Matches{"isrc:MISSING": {CachedAt: now.Add(-48 * time.Hour)}},
+			want:      false,
+		},
+		{
+			name: "some songs not cached",
+			unmatched: map[string]store.UnmatchedSong{
+				"isrc:MISSING": missing,
+				"isrc:OTHER":   {Name: "Other", Artist: "Artist", ISRC: "OTHER"},
+			},
+			cache: store.Matches{"isrc:MISSING": {CachedAt: now.Add(-time.Hour)}},
+			want:  false,
+		},
+		{
+			name:      "found since the last sync",
+			unmatched: map[string]store.UnmatchedSong{"isrc:MISSING": missing},
+			cache: store.Matches{"isrc:MISSING": {
+				Match:    spotify.Match{Found: true},
+				CachedAt: now.Add(-time.Hour),
+			}},
+			want: false,
+		},
+		{
+			name:      "cache disabled",
+			unmatched: map[string]store.UnmatchedSong{"isrc:MISSING": missing},
+			noCache:   true,
+			want:      false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := syncer{
+				stateFile: &store.File[store.State]{Path: filepath.Join(dir, "state.json")},
+				unmatchedFile: &store.File[store.Unmatched]{
+					Path: filepath.Join(dir, "unmatched.json"),
+				},
+			}
+			if !test.noCache {
+				s.executor.Cache = &store.MatchCache{
+					File:        &store.File[store.Matches]{Path: filepath.Join(dir, "matches.json")},
+					TTL:         24 * time.Hour,
+					NegativeTTL: 24 * time.Hour,
+				}
+				err := s.executor.Cache.File.Save(test.cache)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			previous := store.PlaylistState{}
+			current.apply(&previous)
+			if test.snapshot != "" {
+				previous.SnapshotID = test.snapshot
+			}
+			err := s.stateFile.Save(store.State{playlist.AppleMusicID: previous})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.unmatched != nil {
+				err = s.unmatchedFile.Save(store.Unmatched{
+					playlist.AppleMusicID: {Playlist: playlist.Name, Songs: test.unmatched},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.unchanged(playlist, current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// runHistory prints the songs that were added to and removed from playlists, oldest first, as
+// recorded in the audit log.
+func runHistory(audit *store.AuditLog, location *time.Location, args []string) {
+	var (
+		flags    = flag.NewFlagSet("history", flag.ExitOnError)
+		format   = flags.String("format", "text", "output format (text or json)")
+		playlist = flags.String("playlist", "", "only show changes to the playlist with this name")
+		song     = flags.String("song", "", "only show songs with this isrc or name or artist")
+		since    = flags.String("since", "", "only show changes from this date or RFC 3339 time")
+		until    = flags.String("until", "", "only show changes up to this date or RFC 3339 time")
+	)
+	_ = flags.Parse(args)
+	if *format != "text" && *format != "json" {
+		timber.FatalMsg("unknown history format", *format)
+	}
+
+	filter, err := newHistoryFilter(*playlist, *song, *since, *until, location)
+	if err != nil {
+		timber.Fatal(err, "invalid history filter")
+	}
+	entries, err := audit.Entries(filter.keep)
+	if err != nil {
+		timber.Fatal(err, "failed to read audit log")
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entries)
+		if err != nil {
+			timber.Fatal(err, "failed to write history")
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		symbol := "+"
+		switch entry.Action {
+		case store.AuditRemove:
+			symbol = "-"
+		case store.AuditAddToAppleMusic:
+			symbol = "+ apple music"
+		}
+		reason := entry.Reason
+		if entry.MatchedBy != "" {
+			reason += ", " + entry.MatchedBy
+		}
+		fmt.Printf(
+			"%s %s %s \"%s\" by \"%s\" (%s)\n",
+			entry.Time.In(location).Format(time.DateTime),
+			entry.Playlist,
+			symbol,
+			entry.Name,
+			entry.Artist,
+			reason,
+		)
+	}
+}
+
+// historyFilter is which audit entries the history command shows. Empty fields don't filter
+// anything.
+type historyFilter struct {
+	playlist string
+	// song is lowercase so it can be compared with an ISRC or found in a name or artist.
+	song string
+	from time.Time
+	to   time.Time
+}
+
+// newHistoryFilter creates the filter from the flags of the history command. since and until are
+// dates or RFC 3339 times in location, and an until date includes the whole day.
+func newHistoryFilter(
+	playlist string,
+	song string,
+	since string,
+	until string,
+	location *time.Location,
+) (historyFilter, error) {
+	filter := historyFilter{playlist: playlist, song: strings.ToLower(song)}
+	var err error
+	if since != "" {
+		filter.from, _, err = parseHistoryTime(since, location)
+		if err != nil {
+			return historyFilter{}, fmt.Errorf("%w failed to parse -since", err)
+		}
+	}
+	if until != "" {
+		var dateOnly bool
+		filter.to, dateOnly, err = parseHistoryTime(until, location)
+		if err != nil {
+			return historyFilter{}, fmt.Errorf("%w failed to parse -until", err)
+		}
+		if dateOnly {
+			filter.to = filter.to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+	}
+	return filter, nil
+}
+
+func (f historyFilter) keep(entry store.AuditEntry) bool {
+	switch {
+	case f.playlist != "" && entry.Playlist != f.playlist:
+		return false
+	case !f.from.IsZero() && entry.Time.Before(f.from):
+		return false
+	case !f.to.IsZero() && entry.Time.After(f.to):
+		return false
+	case f.song != "":
+		return strings.EqualFold(entry.ISRC, f.song) ||
+			strings.Contains(strings.ToLower(entry.Name), f.song) ||
+			strings.Contains(strings.ToLower(entry.Artist), f.song)
+	default:
+		return true
+	}
+}
+
+// parseHistoryTime parses an RFC 3339 time or a date in location. Whether it was only a date is
+// also returned.
+func parseHistoryTime(value string, location *time.Location) (time.Time, bool, error) {
+	date, err := time.ParseInLocation(time.DateOnly, value, location)
+	if err == nil {
+		return date, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w not a date or RFC 3339 time", err)
+	}
+	return t, false, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+func TestHistoryFilter(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := store.AuditEntry{
+		// 2026-03-10 23:30 in new york
+		Time:     time.Date(2026, time.March, 11, 3, 30, 0, 0, time.UTC),
+		Playlist: "chill",
+		Name:     "Pink + White",
+		Artist:   "Frank Ocean",
+		ISRC:     "USUM71612345",
+	}
+
+	tests := []struct {
+		name     string
+		playlist string
+		song     string
+		since    string
+		until    string
+		want     bool
+	}{
+		{name: "no filters", want: true},
+		{name: "playlist", playlist: "chill", want: true},
+		{name: "other playlist", playlist: "rap", want: false},
+		{name: "isrc", song: "usum71612345", want: true},
+		{name: "name", song: "pink", want: true},
+		{name: "artist", song: "FRANK", want: true},
+		{name: "other song", song: "nights", want: false},
+		{name: "since the date", since: "2026-03-10", want: true},
+		{name: "since the next date", since: "2026-03-11", want: false},
+		{name: "until the date", until: "2026-03-10", want: true},
+		{name: "until the date before", until: "2026-03-09", want: false},
+		{name: "until a time", until: "2026-03-11T03:00:00Z", want: false},
+		{name: "since a time", since: "2026-03-11T03:00:00Z", want: true},
+		{
+			name:     "every filter",
+			playlist: "chill",
+			song:     "ocean",
+			since:    "2026-03-01",
+			until:    "2026-03-31",
+			want:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := newHistoryFilter(
+				test.playlist,
+				test.song,
+				test.since,
+				test.until,
+				newYork,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.keep(entry); got != test.want {
+				t.Errorf("keep() = %t, want %t", got, test.want)
+			}
+		})
+	}
+
+	_, err = newHistoryFilter("", "", "last week", "", newYork)
+	if err == nil {
+		t.Error("expected an error for an invalid -since")
+	}
+}
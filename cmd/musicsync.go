@@ -1,187 +1,198 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"go.mattglei.ch/lcp/pkg/lcp"
+	"go.mattglei.ch/musicsync/internal/apis"
 	"go.mattglei.ch/musicsync/internal/apis/applemusic"
 	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/config"
 	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/schedule"
 	"go.mattglei.ch/musicsync/internal/secrets"
+	"go.mattglei.ch/musicsync/internal/store"
 	"go.mattglei.ch/timber"
 )
 
 func main() {
+	var (
+		sourceKind    = flag.String("source", "lcp", "playlist source (lcp, config, or all)")
+		configPath    = flag.String("config", "config.toml", "path to the local config file")
+		dataDir       = flag.String("data", "data", "directory to store sync state in")
+		overridesPath = flag.String("overrides", "overrides.toml", "path to the song overrides file")
+		dryRun        = flag.Bool("dry-run", false, "print the sync plan for every playlist and exit")
+		poll          = flag.Duration(
+			"poll",
+			5*time.Minute,
+			"how often to re-poll the playlist source for changes (0 disables polling)",
+		)
+	)
+	flag.Parse()
+
 	newYork := setupLogger()
 	timber.Done("booted")
 
 	secrets.Load()
 
+	conf, err := config.Load(*configPath)
+	if err != nil {
+		timber.Fatal(err, "failed to load config")
+	}
+
+	// each api has its own client so that its rate limit is shared by every playlist being synced
 	var (
-		httpClient    = http.Client{Timeout: 20 * time.Second}
-		spotifyClient = spotify.Client{
-			HttpClient: &httpClient,
-			Tokens:     &spotify.Tokens{RefreshToken: secrets.ENV.SpotifyRefreshToken},
+		appleMusicMetrics apis.Metrics
+		spotifyMetrics    apis.Metrics
+		appleMusicClient  = applemusic.NewClient(applemusic.Options{
+			Limiter: apis.NewLimiter(conf.RateLimits.AppleMusic),
+			Metrics: &appleMusicMetrics,
+		})
+		spotifyClient = spotify.NewClient(spotify.Options{
+			RefreshToken: secrets.ENV.SpotifyRefreshToken,
+			Limiter:      apis.NewLimiter(conf.RateLimits.Spotify),
+			Metrics:      &spotifyMetrics,
+		})
+		matchCache = store.MatchCache{
+			File:        &store.File[store.Matches]{Path: filepath.Join(*dataDir, "matches.json")},
+			TTL:         conf.Cache.TTL,
+			NegativeTTL: conf.Cache.NegativeTTL,
+		}
+		scheduleFile = &store.File[store.Schedule]{Path: filepath.Join(*dataDir, "schedule.json")}
+		s            = syncer{
+			appleMusicClient: appleMusicClient,
+			spotifyClient:    spotifyClient,
+			executor: diff.Executor{
+				AppleMusic: appleMusicClient,
+				Spotify:    spotifyClient,
+				Matcher:    conf.Matching.Matcher(),
+				Cache:      &matchCache,
+				Guard:      conf.Guard.Guard(),
+				Snapshots: &store.File[store.Snapshots]{
+					Path: filepath.Join(*dataDir, "snapshots.json"),
+				},
+				Audit: &store.AuditLog{Path: filepath.Join(*dataDir, "audit.jsonl")},
+			},
+			stateFile: &store.File[store.State]{Path: filepath.Join(*dataDir, "state.json")},
+			unmatchedFile: &store.File[store.Unmatched]{
+				Path: filepath.Join(*dataDir, "unmatched.json"),
+			},
+			overridesPath:   *overridesPath,
+			location:        newYork,
+			shutdownTimeout: conf.Sync.ShutdownTimeout,
 		}
 	)
 
-	err := spotifyClient.Authorize()
-	if err != nil {
-		timber.Fatal(err, "failed to authorize spotify")
+	// the cache, unmatched songs, schedule, and audit log are only stored locally so they can be
+	// used without authorizing with spotify
+	switch flag.Arg(0) {
+	case "cache":
+		runCache(matchCache, flag.Args()[1:])
+		return
+	case "unmatched":
+		runUnmatched(s.unmatchedFile, flag.Args()[1:])
+		return
+	case "schedule":
+		runSchedule(scheduleFile, newYork, flag.Args()[1:])
+		return
+	case "history":
+		runHistory(s.executor.Audit, newYork, flag.Args()[1:])
+		return
 	}
 
-	lcpClient := lcp.Client{Token: secrets.ENV.LcpToken}
+	// the first interrupt lets the playlists being synced finish and a second one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	for {
-		err = updateCycle(&httpClient, &spotifyClient, &lcpClient, newYork)
-		if err != nil {
-			timber.Warning("encountered error while trying to update", err.Error())
-		}
+	err = spotifyClient.Authorize(ctx)
+	if err != nil {
+		timber.Fatal(err, "failed to authorize spotify")
 	}
-}
 
-func updateCycle(
-	httpClient *http.Client,
-	spotifyClient *spotify.Client,
-	lcpClient *lcp.Client,
-	newYork *time.Location,
-) error {
-	playlists, err := lcp.FetchAppleMusicSyncedPlaylists(lcpClient)
+	watcher, err := playlistWatcher(*sourceKind, *configPath, *poll)
 	if err != nil {
-		return fmt.Errorf("%w failed to fetch playlists to sync from lcp", err)
+		timber.Fatal(err, "failed to setup playlist source")
+	}
+	err = watcher.Reload()
+	if err != nil {
+		timber.Warning("failed to load playlists", err.Error())
 	}
 
-	for _, playlist := range playlists {
-		fmt.Println()
-
-		if playlist.NoSync {
-			timber.Info(playlist.Name, "has syncing paused. skipping.")
-			continue
-		}
-		timber.Info("Processing", playlist.Name)
-		appleMusicIDs, err := applemusic.PlaylistSongs(httpClient, playlist.AppleMusicID)
-		if err != nil {
-			return fmt.Errorf("%w failed to get apple music playlist", err)
-		}
-		timber.Done("[1/9] Found", len(appleMusicIDs), "songs from playlist in APPLE MUSIC")
-
-		appleMusicSongs, err := applemusic.PlaylistISRCs(httpClient, appleMusicIDs)
-		if err != nil {
-			return fmt.Errorf(
-				"%w failed to get isrc for %d ids from apple music",
-				err,
-				len(appleMusicIDs),
-			)
-		}
-		timber.Done(
-			"[2/9] Got",
-			len(appleMusicSongs),
-			"global isrc values for songs in APPLE MUSIC",
-		)
-
-		spotifySongs, err := spotify.PlaylistSongs(spotifyClient, playlist.SpotifyID)
-		if err != nil {
-			return fmt.Errorf("%w failed to get playlist data", err)
-		}
-		timber.Done(
-			"[3/9] Found",
-			len(spotifySongs),
-			"songs in the current SPOTIFY playlist",
-		)
-
-		spotifyPlaylistSnapshotID, err := spotify.PlaylistSnapshot(
-			spotifyClient,
-			playlist.SpotifyID,
-		)
-		if err != nil {
-			return fmt.Errorf("%w failed to get snapshot id for playlist", err)
-		}
-		timber.Done("[4/9] Got playlist version snapshot")
-
-		toAdd, toDelete := diff.PlaylistDiff(appleMusicSongs, spotifySongs)
-		timber.Done("[5/9]", "Found playlist diff")
-
-		var songsToAdd []spotify.Song
-		if len(toAdd) != 0 {
-			songsToAdd, err = spotify.FindAppleMusicSongs(spotifyClient, toAdd)
-			if err != nil {
-				return fmt.Errorf("%w failed to find isrcs in spotify", err)
-			}
-			timber.Done("[6/9]", "Found", len(songsToAdd), "in spotify from Apple Music")
-		} else {
-			timber.Info("[6/9]", "Skipped as there are no songs in initial to add list")
-		}
-		songsToAdd, toDelete = diff.FilterPlaylists(songsToAdd, toDelete)
-
-		updated := false
-
-		if len(toDelete) != 0 {
-			timber.Info("Deleting", len(toDelete), "songs")
-			for _, song := range toDelete {
-				timber.Infof("- \"%s\" by \"%s\"", song.Name, song.Artist)
-			}
-			err = spotify.EditSongs(
-				spotifyClient,
-				playlist.SpotifyID,
-				toDelete,
-				&spotifyPlaylistSnapshotID,
-			)
-			if err != nil {
-				return fmt.Errorf("%w failed to remove songs from playlist", err)
-			}
-			updated = true
-			timber.Done("[7/9]", "Removed", len(toDelete), "songs")
-		} else {
-			timber.Info("[7/9] Skipped as there are no songs to remove")
-		}
-
-		if len(songsToAdd) != 0 {
-			timber.Info("Adding", len(songsToAdd), "songs")
-			for _, song := range songsToAdd {
-				timber.Infof("+ \"%s\" by \"%s\"", song.Name, song.Artist)
-			}
-			err = spotify.EditSongs(spotifyClient, playlist.SpotifyID, songsToAdd, nil)
-			if err != nil {
-				return fmt.Errorf("%w failed to add songs to playlist", err)
-			}
-			updated = true
-			timber.Done("[8/9]", "Added", len(songsToAdd), "songs")
-		} else {
-			timber.Info("[8/9] Skipped as there are no songs to add")
-		}
-
-		if updated && !playlist.Private {
-			err = spotify.UpdateDescription(
-				spotifyClient,
-				playlist.SpotifyID,
-				playlist.AppleMusicID,
-				newYork,
-			)
-			if err != nil {
-				return fmt.Errorf("%w failed to update playlist description", err)
-			}
-			timber.Info("[9/9] Updated playlist description")
-		} else if playlist.Private {
-			timber.Info("[9/9] Skipped as playlist is private")
-		} else {
-			timber.Info("[9/9] Skipped as playlist didn't get updated")
+	switch command := flag.Arg(0); {
+	case command == "plan":
+		runPlan(ctx, &s, watcher, flag.Args()[1:])
+	case command == "sync":
+		runSync(ctx, &s, watcher, flag.Args()[1:])
+	case command == "rollback":
+		runRollback(ctx, &s, flag.Args()[1:])
+	case command != "":
+		timber.FatalMsg("unknown command", command)
+	case *dryRun:
+		runPlan(ctx, &s, watcher, nil)
+	default:
+		scheduler := schedule.Scheduler{
+			File:            scheduleFile,
+			DefaultInterval: conf.Sync.Interval,
+			Jitter:          conf.Sync.Jitter,
+			Location:        newYork,
 		}
-
-		timber.Info("Waiting 5 minutes before syncing next playlist")
-		time.Sleep(5 * time.Minute)
+		runDaemon(ctx, &s, watcher, &scheduler, conf.Sync.Workers)
 	}
+	timber.Info("[spotify]", spotifyMetrics.Summary())
+	timber.Info("[apple music]", appleMusicMetrics.Summary())
+}
 
-	return nil
+func playlistWatcher(
+	kind string,
+	configPath string,
+	poll time.Duration,
+) (*playlists.Watcher, error) {
+	var (
+		lcpSource  = playlists.LcpSource{Client: &lcp.Client{Token: secrets.ENV.LcpToken}}
+		fileSource = playlists.FileSource{Path: configPath}
+	)
+	switch strings.ToLower(kind) {
+	case "lcp":
+		return &playlists.Watcher{Source: lcpSource, PollInterval: poll}, nil
+	case "config":
+		return &playlists.Watcher{
+			Source:       fileSource,
+			Files:        []string{configPath},
+			PollInterval: poll,
+		}, nil
+	case "all":
+		return &playlists.Watcher{
+			Source:       playlists.Merge(lcpSource, fileSource),
+			Files:        []string{configPath},
+			PollInterval: poll,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown playlist source %q", kind)
+	}
 }
 
+// timeFormat is how times are shown in logs and command output.
+const timeFormat = "01/02 03:04:05 PM MST"
+
 func setupLogger() *time.Location {
 	ny, err := time.LoadLocation("America/New_York")
 	if err != nil {
 		timber.Fatal(err, "failed to load new york timezone")
 	}
 	timber.Timezone(ny)
-	timber.TimeFormat("01/02 03:04:05 PM MST")
+	timber.TimeFormat(timeFormat)
 	return ny
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/timber"
+)
+
+// runPlan prints what syncing each playlist would change without changing anything. If names are
+// given only the playlists with those names are planned. Nothing is printed if ctx is canceled
+// before every playlist is planned.
+func runPlan(ctx context.Context, s *syncer, watcher *playlists.Watcher, args []string) {
+	var (
+		flags  = flag.NewFlagSet("plan", flag.ExitOnError)
+		format = flags.String("format", "text", "output format (text or json)")
+		out    = flags.String("out", "-", "file to write the plan to (- for stdout)")
+	)
+	_ = flags.Parse(args)
+	names := flags.Args()
+	if *format != "text" && *format != "json" {
+		timber.FatalMsg("unknown plan format", *format)
+	}
+
+	plans := []diff.Plan{}
+	for _, playlist := range watcher.Current() {
+		if len(names) != 0 && !slices.Contains(names, playlist.Name) {
+			continue
+		}
+		fmt.Println()
+		if playlist.NoSync {
+			timber.Info(playlist.Name, "has syncing paused. skipping.")
+			continue
+		}
+		plan, err := s.plan(ctx, playlist)
+		if ctx.Err() != nil {
+			timber.Info("Stopped planning to shut down")
+			return
+		}
+		if err != nil {
+			timber.Warning("failed to plan", playlist.Name, err.Error())
+			continue
+		}
+		err = s.executor.Guard.Check(plan)
+		if err != nil {
+			timber.Warning(playlist.Name, "would not be synced:", err.Error())
+		}
+		plans = append(plans, plan)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			timber.Fatal(err, "failed to create", *out)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "json" {
+		err := writePlansJSON(w, plans)
+		if err != nil {
+			timber.Fatal(err, "failed to write plan")
+		}
+		return
+	}
+	fmt.Fprintln(w)
+	writePlansText(w, plans)
+}
+
+func writePlansJSON(w io.Writer, plans []diff.Plan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plans)
+}
+
+func writePlansText(w io.Writer, plans []diff.Plan) {
+	for i, plan := range plans {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%s -> %s)\n", plan.Playlist, plan.AppleMusicID, plan.SpotifyID)
+		if plan.Empty() && len(plan.Unmatched) == 0 && len(plan.Skipped) == 0 {
+			fmt.Fprintln(w, "  no changes")
+			continue
+		}
+		for _, removal := range plan.Removals {
+			fmt.Fprintf(
+				w,
+				"  - \"%s\" by \"%s\" (%s)\n",
+				removal.Song.Name,
+				removal.Song.Artist,
+				removal.Reason,
+			)
+		}
+		for _, addition := range plan.Additions {
+			fmt.Fprintf(
+				w,
+				"  + \"%s\" by \"%s\" (%s, %s with %.2f confidence)\n",
+				addition.Match.Name,
+				addition.Match.Artist,
+				addition.Reason,
+				addition.MatchedBy,
+				addition.Confidence,
+			)
+		}
+		for _, unmatched := range plan.Unmatched {
+			fmt.Fprintf(
+				w,
+				"  ? \"%s\" by \"%s\" (%s)\n",
+				unmatched.Song.Name,
+				unmatched.Song.Artist,
+				unmatched.Reason,
+			)
+		}
+		for _, addition := range plan.AppleMusicAdditions {
+			fmt.Fprintf(
+				w,
+				"  + \"%s\" by \"%s\" to apple music (%s)\n",
+				addition.Match.Name,
+				addition.Match.Artist,
+				addition.Reason,
+			)
+		}
+		for _, move := range plan.Reorders {
+			fmt.Fprintf(
+				w,
+				"  ~ %s from %d to %d\n",
+				move.Summary(),
+				move.RangeStart,
+				move.InsertBefore,
+			)
+		}
+		for _, update := range plan.Metadata {
+			fmt.Fprintf(w, "  %s: %s\n", update.Field, update.Value)
+		}
+		for _, skipped := range plan.Skipped {
+			fmt.Fprintf(w, "  x \"%s\" by \"%s\" (%s)\n", skipped.Name, skipped.Artist, skipped.Reason)
+		}
+	}
+}
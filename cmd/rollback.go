@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// runRollback restores a Spotify playlist to one of the snapshots taken before musicsync changed
+// it. The playlist is given by name or Spotify ID. Without -to the newest snapshot is restored,
+// which undoes the last sync. The playlist is snapshotted again before it is restored so a rollback
+// can be rolled back too.
+func runRollback(ctx context.Context, s *syncer, args []string) {
+	var (
+		flags = flag.NewFlagSet("rollback", flag.ExitOnError)
+		to    = flags.String("to", "", "restore the newest snapshot from before this RFC 3339 time")
+		list  = flags.Bool("list", false, "list the snapshots of the playlist instead of restoring one")
+	)
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		timber.FatalMsg("usage: musicsync rollback <playlist> [-to <time>] [-list]")
+	}
+	name := flags.Arg(0)
+	// flags can also come after the playlist
+	_ = flags.Parse(flags.Args()[1:])
+
+	snapshots, err := s.executor.Snapshots.Load()
+	if err != nil {
+		timber.Fatal(err, "failed to load snapshots")
+	}
+	spotifyID, playlist, ok := findSnapshots(snapshots, name)
+	if !ok {
+		timber.FatalMsg("no snapshots of", name)
+	}
+
+	if *list {
+		for _, snapshot := range playlist.Snapshots {
+			fmt.Printf(
+				"%s: %d songs (%s)\n",
+				snapshot.TakenAt.In(s.location).Format(time.RFC3339),
+				len(snapshot.Songs),
+				snapshot.SnapshotID,
+			)
+		}
+		return
+	}
+
+	at := time.Now()
+	if *to != "" {
+		at, err = time.Parse(time.RFC3339, *to)
+		if err != nil {
+			timber.Fatal(err, "failed to parse time to roll back to")
+		}
+	}
+	snapshot, ok := playlist.At(at)
+	if !ok {
+		timber.FatalMsg("no snapshots of", playlist.Playlist, "from before", *to)
+	}
+
+	err = s.rollback(ctx, spotifyID, playlist.Playlist, snapshot)
+	if err != nil {
+		timber.Fatal(err, "failed to roll back", playlist.Playlist)
+	}
+	timber.Done(
+		"Rolled back",
+		playlist.Playlist,
+		"to",
+		snapshot.TakenAt.In(s.location).Format(timeFormat),
+		"with",
+		len(snapshot.Songs),
+		"songs",
+	)
+	timber.Warning(
+		"the next sync will change the playlist again unless it is paused or the source is changed",
+	)
+}
+
+// rollback snapshots the playlist as it is now and then replaces its songs with the songs from
+// snapshot.
+func (s *syncer) rollback(
+	ctx context.Context,
+	spotifyID string,
+	playlist string,
+	snapshot store.Snapshot,
+) error {
+	snapshotID, err := spotify.PlaylistSnapshot(ctx, s.spotifyClient, spotifyID)
+	if err != nil {
+		return fmt.Errorf("%w failed to get snapshot id for playlist", err)
+	}
+	songs, err := spotify.PlaylistSongs(ctx, s.spotifyClient, spotifyID)
+	if err != nil {
+		return fmt.Errorf("%w failed to get playlist data", err)
+	}
+	err = s.executor.Snapshots.Update(func(snapshots *store.Snapshots) error {
+		snapshots.Add(spotifyID, playlist, store.Snapshot{
+			TakenAt:    time.Now(),
+			SnapshotID: snapshotID,
+			Songs:      songs,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w failed to save snapshot of playlist", err)
+	}
+
+	// once songs start being replaced they are all replaced so the playlist isn't left half restored
+	err = spotify.ReplaceSongs(context.WithoutCancel(ctx), s.spotifyClient, spotifyID, snapshot.Songs)
+	if err != nil {
+		return fmt.Errorf("%w failed to replace songs in playlist", err)
+	}
+	return nil
+}
+
+// findSnapshots finds the snapshots of the playlist with the given name or Spotify ID.
+func findSnapshots(snapshots store.Snapshots, name string) (string, store.PlaylistSnapshots, bool) {
+	if playlist, ok := snapshots[name]; ok {
+		return name, playlist, true
+	}
+	for spotifyID, playlist := range snapshots {
+		if playlist.Playlist == name {
+			return spotifyID, playlist, true
+		}
+	}
+	return "", store.PlaylistSnapshots{}, false
+}
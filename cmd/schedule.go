@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/schedule"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// runSchedule prints when each playlist was last synced and when it is next due, as saved by the
+// running daemon.
+func runSchedule(scheduleFile *store.File[store.Schedule], location *time.Location, args []string) {
+	var (
+		flags  = flag.NewFlagSet("schedule", flag.ExitOnError)
+		format = flags.String("format", "text", "output format (text or json)")
+	)
+	_ = flags.Parse(args)
+	if *format != "text" && *format != "json" {
+		timber.FatalMsg("unknown schedule format", *format)
+	}
+
+	saved, err := scheduleFile.Load()
+	if err != nil {
+		timber.Fatal(err, "failed to load schedule")
+	}
+	runs := schedule.Upcoming(saved)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(runs)
+		if err != nil {
+			timber.Fatal(err, "failed to write schedule")
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, run := range runs {
+		lastRun := "never"
+		if !run.LastRun.IsZero() {
+			lastRun = run.LastRun.In(location).Format(timeFormat)
+		}
+		if run.Disabled != "" {
+			fmt.Printf("%s: disabled (%s), last synced %s\n", run.Playlist, run.Disabled, lastRun)
+			continue
+		}
+		fmt.Printf(
+			"%s: next sync at %s (in %s), last synced %s\n",
+			run.Playlist,
+			run.NextRun.In(location).Format(timeFormat),
+			max(run.NextRun.Sub(now), 0).Round(time.Second),
+			lastRun,
+		)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/overrides"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/schedule"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// errShutdownTimeout is the cause of changes being aborted because they didn't finish within the
+// shutdown timeout.
+var errShutdownTimeout = errors.New("shutdown timeout passed")
+
+type syncer struct {
+	appleMusicClient *applemusic.Client
+	spotifyClient    *spotify.Client
+	executor         diff.Executor
+	stateFile        *store.File[store.State]
+	unmatchedFile    *store.File[store.Unmatched]
+	overridesPath    string
+	location         *time.Location
+	// shutdownTimeout is how long changes that are being made get to finish once ctx is canceled.
+	shutdownTimeout time.Duration
+}
+
+// runDaemon syncs each playlist whenever it is due according to the scheduler. Due playlists are
+// synced by a pool of workers and throttled by the rate limits of the API clients. Once ctx is
+// canceled no more playlists are started and runDaemon returns after the playlists that are being
+// synced finish or abort.
+func runDaemon(
+	ctx context.Context,
+	s *syncer,
+	watcher *playlists.Watcher,
+	scheduler *schedule.Scheduler,
+	workers int,
+) {
+	err := watcher.Watch()
+	if err != nil {
+		timber.Fatal(err, "failed to watch playlist source")
+	}
+
+	var (
+		queue = make(chan playlists.Playlist)
+		wg    sync.WaitGroup
+	)
+	for range workers {
+		wg.Go(func() {
+			for playlist := range queue {
+				s.syncScheduled(ctx, scheduler, playlist)
+			}
+		})
+	}
+	defer func() {
+		timber.Info("Shutting down once the playlists being synced finish")
+		close(queue)
+		wg.Wait()
+		timber.Done("Shut down")
+	}()
+
+	err = scheduler.Update(watcher.Current())
+	if err != nil {
+		timber.Warning("failed to update schedule", err.Error())
+	}
+	for _, run := range scheduler.Upcoming() {
+		timber.Info(run.Playlist, "next sync at", run.NextRun.In(s.location).Format(timeFormat))
+	}
+
+	for {
+		// playlists are picked up from the watcher every time around so config changes are
+		// scheduled without waiting for the next sync
+		err = scheduler.Update(watcher.Current())
+		if err != nil {
+			timber.Warning("failed to update schedule", err.Error())
+		}
+		for _, playlist := range scheduler.Due(time.Now()) {
+			select {
+			case queue <- playlist:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		wait := time.Minute
+		if next, ok := scheduler.NextRun(); ok {
+			wait = min(wait, max(time.Until(next), 0))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runSync syncs the playlists once and exits. If names are given only the playlists with those
+// names are synced. -force applies plans that remove more songs than the guard allows.
+func runSync(ctx context.Context, s *syncer, watcher *playlists.Watcher, args []string) {
+	var (
+		flags = flag.NewFlagSet("sync", flag.ExitOnError)
+		force = flags.Bool("force", false, "apply plans that remove more songs than the guard allows")
+	)
+	_ = flags.Parse(args)
+	names := flags.Args()
+
+	if *force {
+		forced := *s
+		forced.executor.Guard = diff.Guard{}
+		s = &forced
+	}
+	for _, playlist := range watcher.Current() {
+		if len(names) != 0 && !slices.Contains(names, playlist.Name) {
+			continue
+		}
+		if playlist.NoSync {
+			timber.Info(playlist.Name, "has syncing paused. skipping.")
+			continue
+		}
+
+		err := s.sync(ctx, playlist)
+		if ctx.Err() != nil {
+			timber.Info("Stopped syncing to shut down")
+			return
+		}
+		if err != nil {
+			timber.Warning("failed to sync", playlist.Name, err.Error())
+		}
+	}
+}
+
+// syncScheduled syncs a playlist and schedules its next sync.
+func (s *syncer) syncScheduled(
+	ctx context.Context,
+	scheduler *schedule.Scheduler,
+	playlist playlists.Playlist,
+) {
+	err := s.sync(ctx, playlist)
+	switch {
+	case errors.Is(err, errShutdownTimeout):
+		timber.Warning(
+			"["+playlist.Name+"]",
+			"Aborted part way through changing the playlist as the shutdown timeout passed:",
+			err.Error(),
+		)
+		return
+	case errors.Is(err, context.Canceled):
+		timber.Info("["+playlist.Name+"]", "Aborted before changing anything to shut down")
+		return
+	case errors.Is(err, spotify.ErrPlaylistNotFound),
+		errors.Is(err, applemusic.ErrPlaylistNotFound):
+		timber.Warning(
+			"disabling",
+			playlist.Name,
+			"until its spotify id changes or musicsync restarts:",
+			err.Error(),
+		)
+		err = scheduler.Disable(playlist.AppleMusicID, err.Error())
+		if err != nil {
+			timber.Warning("failed to disable", playlist.Name, err.Error())
+		}
+		return
+	case errors.Is(err, diff.ErrTooManyRemovals):
+		timber.Warning(
+			"refused to sync",
+			playlist.Name,
+			err.Error(),
+			"(run the sync command with -force if this is intentional)",
+		)
+	case err != nil:
+		timber.Warning("encountered error while trying to update", playlist.Name, err.Error())
+	}
+
+	next, err := scheduler.Finished(playlist.AppleMusicID, time.Now())
+	if err != nil {
+		timber.Warning("failed to schedule next sync of", playlist.Name, err.Error())
+	} else if !next.IsZero() {
+		timber.Info("["+playlist.Name+"]", "Next sync at", next.In(s.location).Format(timeFormat))
+	}
+}
+
+// sync syncs the playlist unless neither side of it changed since the last sync.
+func (s *syncer) sync(ctx context.Context, playlist playlists.Playlist) error {
+	current, err := s.currentVersions(ctx, playlist)
+	if err != nil {
+		return err
+	}
+	unchanged, err := s.unchanged(playlist, current)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		timber.Info("["+playlist.Name+"]", "Skipped as neither playlist changed since the last sync")
+		return nil
+	}
+
+	plan, err := s.plan(ctx, playlist)
+	if err != nil {
+		return err
+	}
+	err = s.recordUnmatched(plan)
+	if err != nil {
+		return fmt.Errorf("%w failed to save unmatched songs", err)
+	}
+	return s.apply(ctx, playlist, plan, current)
+}
+
+// plan fetches both playlists and works out what needs to change without changing anything.
+func (s *syncer) plan(ctx context.Context, playlist playlists.Playlist) (diff.Plan, error) {
+	prefix := "[" + playlist.Name + "]"
+	timber.Info(prefix, "Processing")
+	appleMusicIDs, err := applemusic.PlaylistSongs(ctx, s.appleMusicClient, playlist.AppleMusicID)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf("%w failed to get apple music playlist", err)
+	}
+	timber.Done(prefix, "[1/10] Found", len(appleMusicIDs), "songs from playlist in APPLE MUSIC")
+
+	appleMusicSongs, err := applemusic.PlaylistISRCs(ctx, s.appleMusicClient, appleMusicIDs)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf(
+			"%w failed to get isrc for %d ids from apple music",
+			err,
+			len(appleMusicIDs),
+		)
+	}
+	timber.Done(
+		prefix,
+		"[2/10] Got",
+		len(appleMusicSongs),
+		"global isrc values for songs in APPLE MUSIC",
+	)
+
+	// songs are removed by their positions, which are only valid for the version of the playlist
+	// they were read from, so the snapshot is taken before the songs are read and checked after
+	snapshotID, err := spotify.PlaylistSnapshot(ctx, s.spotifyClient, playlist.SpotifyID)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf("%w failed to get snapshot id for playlist", err)
+	}
+	timber.Done(prefix, "[3/10] Got playlist version snapshot")
+
+	spotifySongs, err := spotify.PlaylistSongs(ctx, s.spotifyClient, playlist.SpotifyID)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf("%w failed to get playlist data", err)
+	}
+	after, err := spotify.PlaylistSnapshot(ctx, s.spotifyClient, playlist.SpotifyID)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf("%w failed to get snapshot id for playlist", err)
+	}
+	if after != snapshotID {
+		return diff.Plan{}, errors.New("spotify playlist changed while its songs were being read")
+	}
+	timber.Done(
+		prefix,
+		"[4/10] Found",
+		len(spotifySongs),
+		"songs in the current SPOTIFY playlist",
+	)
+
+	input := diff.Input{
+		Playlist:        playlist.Name,
+		AppleMusicID:    playlist.AppleMusicID,
+		SpotifyID:       playlist.SpotifyID,
+		SnapshotID:      snapshotID,
+		AppleMusicSongs: appleMusicSongs,
+		SpotifySongs:    spotifySongs,
+		Bidirectional:   playlist.Bidirectional,
+		ConflictPolicy:  playlist.ConflictPolicy,
+	}
+	input.Overrides, err = overrides.Load(s.overridesPath)
+	if err != nil {
+		return diff.Plan{}, fmt.Errorf("%w failed to load overrides", err)
+	}
+	if !playlist.Private {
+		input.Description = spotify.Description(playlist.AppleMusicID, s.location)
+	}
+	if playlist.Bidirectional {
+		state, err := s.stateFile.Load()
+		if err != nil {
+			return diff.Plan{}, fmt.Errorf("%w failed to load sync state", err)
+		}
+		input.Previous = state[playlist.AppleMusicID].Songs
+	}
+
+	return s.executor.Plan(ctx, input)
+}
+
+// apply makes the changes from a plan and records the new sync state. before are the versions of
+// the playlist from before the plan was made. The Spotify version is replaced with the snapshot ID
+// from the last change to the playlist and the Apple Music version is kept, so a change made to
+// the Apple Music playlist while syncing is picked up by the next sync. Once the changes start
+// being made they get the shutdown timeout to finish after ctx is canceled so that a shutdown
+// doesn't leave a playlist half synced, but a request that keeps failing can't hold it up forever.
+func (s *syncer) apply(
+	ctx context.Context,
+	playlist playlists.Playlist,
+	plan diff.Plan,
+	before versions,
+) error {
+	applyCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancel(nil)
+	stop := context.AfterFunc(ctx, func() {
+		select {
+		case <-time.After(s.shutdownTimeout):
+			cancel(errShutdownTimeout)
+		case <-applyCtx.Done():
+		}
+	})
+	defer stop()
+
+	snapshotID, err := s.executor.Apply(applyCtx, plan)
+	if cause := context.Cause(applyCtx); err != nil && errors.Is(cause, errShutdownTimeout) {
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.snapshotID = snapshotID
+
+	err = s.stateFile.Update(func(state *store.State) error {
+		if *state == nil {
+			*state = store.State{}
+		}
+		playlistState := store.PlaylistState{}
+		if playlist.Bidirectional {
+			playlistState.Songs = plan.StateKeys()
+		}
+		after.apply(&playlistState)
+		(*state)[playlist.AppleMusicID] = playlistState
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w failed to save sync state", err)
+	}
+	return nil
+}
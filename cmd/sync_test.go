@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis"
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/match"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/schedule"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+var testPlaylist = playlists.Playlist{
+	Name:         "test",
+	AppleMusicID: "p.test",
+	SpotifyID:    "spotify",
+	Private:      true,
+}
+
+// newTestSyncer creates a syncer between fakes of Spotify and Apple Music that both have the songs
+// one through five in their catalogs. Everything it saves goes to a temporary directory.
+func newTestSyncer(t *testing.T) (*syncer, *fake.Spotify, *fake.AppleMusic) {
+	t.Helper()
+	spotifyFake := fake.NewSpotify("refresh-token")
+	t.Cleanup(spotifyFake.Close)
+	appleMusicFake := fake.NewAppleMusic()
+	t.Cleanup(appleMusicFake.Close)
+	// small pages so that every playlist takes more than one request
+	spotifyFake.PageSize = 2
+	appleMusicFake.PageSize = 2
+
+	for i, name := range []string{"one", "two", "three", "four", "five"} {
+		isrc := "ISRC" + name
+		duration := 200_000 + i*1_000
+		appleMusicFake.AddSongs(fake.Song{
+			ID:             "a." + name,
+			ISRC:           isrc,
+			Name:           name,
+			Artist:         "band",
+			DurationMillis: duration,
+		})
+		spotifyFake.AddTracks(fake.Track{
+			ID:             name,
+			ISRC:           isrc,
+			Name:           name,
+			Artists:        []string{"band"},
+			DurationMillis: duration,
+		})
+	}
+	spotifyFake.AddTracks(fake.Track{ID: "old", ISRC: "ISRCold", Name: "old", Artists: []string{"x"}})
+
+	spotifyClient := spotifyFake.Client()
+	err := spotifyClient.Authorize(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	appleMusicClient := appleMusicFake.Client()
+	dir := t.TempDir()
+	s := &syncer{
+		appleMusicClient: appleMusicClient,
+		spotifyClient:    spotifyClient,
+		executor: diff.Executor{
+			AppleMusic: appleMusicClient,
+			Spotify:    spotifyClient,
+			Matcher: match.Matcher{
+				Threshold:     match.DefaultThreshold,
+				MinConfidence: match.DefaultConfidence,
+			},
+			Cache: &store.MatchCache{
+				File:        &store.File[store.Matches]{Path: filepath.Join(dir, "matches.json")},
+				TTL:         time.Hour,
+				NegativeTTL: time.Hour,
+			},
+			Snapshots: &store.File[store.Snapshots]{Path: filepath.Join(dir, "snapshots.json")},
+			Audit:     &store.AuditLog{Path: filepath.Join(dir, "audit.jsonl")},
+		},
+		stateFile:     &store.File[store.State]{Path: filepath.Join(dir, "state.json")},
+		unmatchedFile: &store.File[store.Unmatched]{Path: filepath.Join(dir, "unmatched.json")},
+		overridesPath: filepath.Join(dir, "overrides.toml"),
+		location:      time.UTC,
+	}
+	return s, spotifyFake, appleMusicFake
+}
+
+func TestSync(t *testing.T) {
+	s, spotifyFake, appleMusicFake := newTestSyncer(t)
+	appleMusicFake.SetPlaylist(
+		testPlaylist.AppleMusicID,
+		"a.one", "a.two", "a.three", "a.four", "a.five",
+	)
+	spotifyFake.SetPlaylist(testPlaylist.SpotifyID, "old", "three", "one")
+
+	steps := []struct {
+		name string
+		// appleMusic replaces the songs of the apple music playlist, which changes its version
+		// even if they are the same songs. nil leaves the playlist alone.
+		appleMusic []string
+		want       []string
+		actions    []store.AuditAction
+		// skipped is if the sync should be skipped without looking up or searching for songs
+		skipped bool
+	}{
+		{
+			name:       "add, remove, and reorder",
+			appleMusic: []string{"a.one", "a.two", "a.three", "a.four", "a.five"},
+			want:       []string{"one", "two", "three", "four", "five"},
+			actions: []store.AuditAction{
+				store.AuditRemove, store.AuditAdd, store.AuditAdd, store.AuditAdd,
+			},
+		},
+		{
+			name:       "remove and reorder",
+			appleMusic: []string{"a.five", "a.one", "a.three"},
+			want:       []string{"five", "one", "three"},
+			actions:    []store.AuditAction{store.AuditRemove, store.AuditRemove},
+		},
+		{
+			name:    "unchanged since the changes",
+			want:    []string{"five", "one", "three"},
+			skipped: true,
+		},
+		{
+			name:       "same songs",
+			appleMusic: []string{"a.five", "a.one", "a.three"},
+			want:       []string{"five", "one", "three"},
+		},
+		{
+			name:    "unchanged",
+			want:    []string{"five", "one", "three"},
+			skipped: true,
+		},
+	}
+	const (
+		catalogSongs = "GET /v1/catalog/{storefront}/songs"
+		search       = "GET /v1/search"
+	)
+	for _, step := range steps {
+		// the steps build on each other so they aren't subtests
+		if step.appleMusic != nil {
+			appleMusicFake.SetPlaylist(testPlaylist.AppleMusicID, step.appleMusic...)
+		}
+		before, err := s.executor.Audit.Entries(func(store.AuditEntry) bool { return true })
+		if err != nil {
+			t.Fatal(err)
+		}
+		stateBefore, err := os.Stat(s.stateFile.Path)
+		if step.skipped && err != nil {
+			t.Fatal(err)
+		}
+		var (
+			catalogBefore = appleMusicFake.Requests(catalogSongs)
+			searchBefore  = spotifyFake.Requests(search)
+		)
+
+		err = s.sync(t.Context(), testPlaylist)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if step.skipped {
+			if n := appleMusicFake.Requests(catalogSongs) - catalogBefore; n != 0 {
+				t.Errorf("%s: sent %d apple music catalog requests, want 0", step.name, n)
+			}
+			if n := spotifyFake.Requests(search) - searchBefore; n != 0 {
+				t.Errorf("%s: sent %d spotify search requests, want 0", step.name, n)
+			}
+			stateAfter, err := os.Stat(s.stateFile.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !stateAfter.ModTime().Equal(stateBefore.ModTime()) {
+				t.Errorf("%s: state was saved again", step.name)
+			}
+		} else if appleMusicFake.Requests(catalogSongs) == catalogBefore {
+			t.Errorf("%s: sync was skipped", step.name)
+		}
+
+		got, _, ok := spotifyFake.Playlist(testPlaylist.SpotifyID)
+		if !ok {
+			t.Fatalf("%s: spotify playlist is missing", step.name)
+		}
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: spotify playlist = %v, want %v", step.name, got, step.want)
+		}
+		after, err := s.executor.Audit.Entries(func(store.AuditEntry) bool { return true })
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions := []store.AuditAction{}
+		for _, entry := range after[len(before):] {
+			actions = append(actions, entry.Action)
+		}
+		if !slices.Equal(actions, step.actions) {
+			t.Errorf("%s: audited %v, want %v", step.name, actions, step.actions)
+		}
+	}
+}
+
+func TestSyncScheduledDisablesMissingPlaylist(t *testing.T) {
+	tests := []struct {
+		name       string
+		spotify    bool
+		appleMusic bool
+	}{
+		{name: "missing from spotify", appleMusic: true},
+		{name: "missing from apple music", spotify: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, spotifyFake, appleMusicFake := newTestSyncer(t)
+			if test.spotify {
+				spotifyFake.SetPlaylist(testPlaylist.SpotifyID, "one")
+			}
+			if test.appleMusic {
+				appleMusicFake.SetPlaylist(testPlaylist.AppleMusicID, "a.one")
+			}
+			scheduler := &schedule.Scheduler{DefaultInterval: time.Hour, Location: time.UTC}
+			err := scheduler.Update([]playlists.Playlist{testPlaylist})
+			if err != nil {
+				t.Fatal(err)
+			}
+			due := scheduler.Due(time.Now())
+			if len(due) != 1 {
+				t.Fatalf("got %d due playlists, want 1", len(due))
+			}
+
+			s.syncScheduled(t.Context(), scheduler, due[0])
+
+			runs := scheduler.Upcoming()
+			if len(runs) != 1 || runs[0].Disabled == "" {
+				t.Fatalf("playlist wasn't disabled: %+v", runs)
+			}
+			if _, ok := scheduler.NextRun(); ok {
+				t.Error("got a next run for the disabled playlist")
+			}
+			if ids, _, ok := spotifyFake.Playlist(testPlaylist.SpotifyID); test.spotify &&
+				(!ok || !slices.Equal(ids, []string{"one"})) {
+				t.Errorf("spotify playlist changed to %v", ids)
+			}
+		})
+	}
+}
+
+type staticSource []playlists.Playlist
+
+func (s staticSource) Playlists() ([]playlists.Playlist, error) {
+	return s, nil
+}
+
+// TestRunDaemon runs the daemon with more playlists than workers and syncs that take longer than
+// the interval of the playlists, so playlists are due again while they are still being synced.
+func TestRunDaemon(t *testing.T) {
+	const (
+		workers = 2
+		delay   = 250 * time.Millisecond
+	)
+	s, spotifyFake, appleMusicFake := newTestSyncer(t)
+	current := staticSource{}
+	for _, name := range []string{"one", "two", "three"} {
+		playlist := playlists.Playlist{
+			Name:         name,
+			AppleMusicID: "p." + name,
+			SpotifyID:    strings.Repeat("0", 22-len(name)) + name,
+			Private:      true,
+			Interval:     time.Second,
+		}
+		appleMusicFake.SetPlaylist(playlist.AppleMusicID, "a."+name)
+		spotifyFake.SetPlaylist(playlist.SpotifyID, name)
+		current = append(current, playlist)
+	}
+
+	// requests to each playlist are counted while they are slowed down so syncs of the same
+	// playlist would overlap if they ever ran at the same time
+	var (
+		mutex      sync.Mutex
+		inFlight   = map[string]int{}
+		total      int
+		maxTotal   int
+		overlapped []string
+		requested  = map[string]bool{}
+	)
+	transport := apis.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		id, ok := strings.CutPrefix(req.URL.Path, "/v1/playlists/")
+		if !ok {
+			return http.DefaultTransport.RoundTrip(req)
+		}
+		id, _, _ = strings.Cut(id, "/")
+		mutex.Lock()
+		inFlight[id]++
+		total++
+		maxTotal = max(maxTotal, total)
+		requested[id] = true
+		if inFlight[id] > 1 {
+			overlapped = append(overlapped, id)
+		}
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			inFlight[id]--
+			total--
+			mutex.Unlock()
+		}()
+		time.Sleep(delay)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	s.spotifyClient = spotify.NewClient(spotify.Options{
+		Transport:    transport,
+		RefreshToken: "refresh-token",
+		BaseURL:      spotifyFake.URL,
+		AccountsURL:  spotifyFake.URL,
+	})
+	s.executor.Spotify = s.spotifyClient
+	err := s.spotifyClient.Authorize(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := &playlists.Watcher{Source: current}
+	err = watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := &schedule.Scheduler{DefaultInterval: time.Hour, Location: time.UTC}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		runDaemon(ctx, s, watcher, scheduler, workers)
+		close(done)
+	}()
+
+	time.Sleep(10 * delay)
+	cancel()
+	// the scheduler loop is waiting to hand the third playlist to a worker, which must not keep
+	// the daemon from shutting down
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon didn't shut down")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(overlapped) != 0 {
+		t.Errorf("playlists %v were synced more than once at the same time", overlapped)
+	}
+	if maxTotal > workers {
+		t.Errorf("%d playlists were synced at the same time with %d workers", maxTotal, workers)
+	}
+	for _, playlist := range current {
+		if !requested[playlist.SpotifyID] {
+			t.Errorf("%s was never synced", playlist.Name)
+		}
+	}
+}
+
+func TestApplyAfterShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		// hang is if adding songs hangs until the request is canceled
+		hang    bool
+		want    []string
+		wantErr error
+	}{
+		{name: "finishes", want: []string{"one", "two"}},
+		{name: "aborted", hang: true, want: []string{"one"}, wantErr: errShutdownTimeout},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, spotifyFake, appleMusicFake := newTestSyncer(t)
+			appleMusicFake.SetPlaylist(testPlaylist.AppleMusicID, "a.one", "a.two")
+			spotifyFake.SetPlaylist(testPlaylist.SpotifyID, "one")
+			s.shutdownTimeout = 50 * time.Millisecond
+			s.spotifyClient = spotify.NewClient(spotify.Options{
+				Transport: apis.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if test.hang && req.Method == http.MethodPost &&
+						strings.HasSuffix(req.URL.Path, "/tracks") {
+						<-req.Context().Done()
+						return nil, req.Context().Err()
+					}
+					return http.DefaultTransport.RoundTrip(req)
+				}),
+				RefreshToken: "refresh-token",
+				BaseURL:      spotifyFake.URL,
+				AccountsURL:  spotifyFake.URL,
+			})
+			s.executor.Spotify = s.spotifyClient
+			err := s.spotifyClient.Authorize(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before, err := s.currentVersions(t.Context(), testPlaylist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := s.plan(t.Context(), testPlaylist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+
+			err = s.apply(ctx, testPlaylist, plan, before)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("apply() = %v, want %v", err, test.wantErr)
+			}
+			if got, _, _ := spotifyFake.Playlist(testPlaylist.SpotifyID); !slices.Equal(got, test.want) {
+				t.Errorf("spotify playlist = %v, want %v", got, test.want)
+			}
+			state, err := s.stateFile.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, saved := state[testPlaylist.AppleMusicID]; saved != (test.wantErr == nil) {
+				t.Errorf("state saved = %t, want %t", saved, test.wantErr == nil)
+			}
+		})
+	}
+}
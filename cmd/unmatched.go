@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// recordUnmatched replaces the unmatched songs of the playlist with the ones from the plan,
+// keeping when each song was first seen. Songs that are unmatched for the first time are logged.
+func (s *syncer) recordUnmatched(plan diff.Plan) error {
+	now := time.Now()
+	return s.unmatchedFile.Update(func(unmatched *store.Unmatched) error {
+		if *unmatched == nil {
+			*unmatched = store.Unmatched{}
+		}
+		previous := (*unmatched)[plan.AppleMusicID].Songs
+		current := store.PlaylistUnmatched{
+			Playlist: plan.Playlist,
+			Songs:    make(map[string]store.UnmatchedSong, len(plan.Unmatched)),
+		}
+		for _, unmatched := range plan.Unmatched {
+			song := unmatched.Song
+			key := store.MatchKey(song)
+			if key == "" {
+				key = diff.SongKey("", song.Name, song.Artist)
+			}
+			firstSeen := now
+			if existing, ok := previous[key]; ok {
+				firstSeen = existing.FirstSeen
+			} else {
+				timber.Warning(
+					fmt.Sprintf("\"%s\" by \"%s\"", song.Name, song.Artist),
+					"couldn't be found in SPOTIFY:",
+					string(unmatched.Reason),
+				)
+			}
+			current.Songs[key] = store.UnmatchedSong{
+				Name:         song.Name,
+				Artist:       song.Artist,
+				ISRC:         song.ISRC,
+				AppleMusicID: song.ID,
+				Reason:       string(unmatched.Reason),
+				FirstSeen:    firstSeen,
+				LastSeen:     now,
+			}
+		}
+		if len(current.Songs) == 0 {
+			delete(*unmatched, plan.AppleMusicID)
+		} else {
+			(*unmatched)[plan.AppleMusicID] = current
+		}
+		return nil
+	})
+}
+
+// runUnmatched prints the songs that couldn't be found on Spotify at the last sync of each
+// playlist. If names are given only the playlists with those names are printed.
+func runUnmatched(unmatchedFile *store.File[store.Unmatched], args []string) {
+	var (
+		flags  = flag.NewFlagSet("unmatched", flag.ExitOnError)
+		format = flags.String("format", "text", "output format (text or json)")
+	)
+	_ = flags.Parse(args)
+	names := flags.Args()
+	if *format != "text" && *format != "json" {
+		timber.FatalMsg("unknown unmatched format", *format)
+	}
+
+	unmatched, err := unmatchedFile.Load()
+	if err != nil {
+		timber.Fatal(err, "failed to load unmatched songs")
+	}
+	if len(names) != 0 {
+		maps.DeleteFunc(unmatched, func(_ string, playlist store.PlaylistUnmatched) bool {
+			return !slices.Contains(names, playlist.Playlist)
+		})
+	}
+	if unmatched == nil {
+		unmatched = store.Unmatched{}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(unmatched)
+		if err != nil {
+			timber.Fatal(err, "failed to write unmatched songs")
+		}
+		return
+	}
+
+	ids := slices.SortedFunc(maps.Keys(unmatched), func(a, b string) int {
+		return cmp.Compare(unmatched[a].Playlist, unmatched[b].Playlist)
+	})
+	for i, id := range ids {
+		if i != 0 {
+			fmt.Println()
+		}
+		playlist := unmatched[id]
+		fmt.Printf("%s (%s)\n", playlist.Playlist, id)
+		songs := slices.SortedFunc(maps.Values(playlist.Songs), func(a, b store.UnmatchedSong) int {
+			return a.FirstSeen.Compare(b.FirstSeen)
+		})
+		for _, song := range songs {
+			fmt.Printf(
+				"  ? \"%s\" by \"%s\" (isrc %s, apple music %s): %s, first seen %s\n",
+				song.Name,
+				song.Artist,
+				song.ISRC,
+				song.AppleMusicID,
+				song.Reason,
+				song.FirstSeen.Format(time.DateTime),
+			)
+		}
+	}
+}
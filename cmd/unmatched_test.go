@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+func TestRecordUnmatched(t *testing.T) {
+	s, _, _ := newTestSyncer(t)
+	var (
+		one = applemusic.Song{ID: "a.one", ISRC: "ISRCone", Name: "one", Artist: "band"}
+		two = applemusic.Song{ID: "a.two", Name: "two", Artist: "band"}
+	)
+	record := func(songs ...applemusic.Song) store.Unmatched {
+		t.Helper()
+		plan := diff.Plan{Playlist: testPlaylist.Name, AppleMusicID: testPlaylist.AppleMusicID}
+		for _, song := range songs {
+			plan.Unmatched = append(plan.Unmatched, diff.Unmatched{Song: song, Reason: "not found"})
+		}
+		err := s.recordUnmatched(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unmatched, err := s.unmatchedFile.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return unmatched
+	}
+
+	first := record(one, two)[testPlaylist.AppleMusicID].Songs
+	if len(first) != 2 {
+		t.Fatalf("recorded %+v, want 2 songs", first)
+	}
+
+	// one was found so it is cleared and two keeps when it was first seen
+	second := record(two)[testPlaylist.AppleMusicID].Songs
+	if _, ok := second[store.MatchKey(one)]; ok || len(second) != 1 {
+		t.Errorf("recorded %+v, want only two", second)
+	}
+	key := store.MatchKey(two)
+	if !second[key].FirstSeen.Equal(first[key].FirstSeen) {
+		t.Errorf("first seen changed from %s to %s", first[key].FirstSeen, second[key].FirstSeen)
+	}
+	if second[key].LastSeen.Before(first[key].LastSeen) {
+		t.Errorf("last seen went back from %s to %s", first[key].LastSeen, second[key].LastSeen)
+	}
+
+	if unmatched := record(); len(unmatched) != 0 {
+		t.Errorf("playlist without unmatched songs was kept: %+v", unmatched)
+	}
+}
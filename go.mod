@@ -3,11 +3,16 @@ module go.mattglei.ch/musicsync
 go 1.25.5
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/caarlos0/env/v11 v11.3.1
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/joho/godotenv v1.5.1
+	github.com/robfig/cron/v3 v3.0.1
 	go.mattglei.ch/lcp v1.6.2
 	go.mattglei.ch/timber v1.5.1
+	golang.org/x/text v0.40.0
+	golang.org/x/time v0.15.0
 )
 
 require (
@@ -1,28 +1,122 @@
 package applemusic
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"go.mattglei.ch/musicsync/internal/apis"
 	"go.mattglei.ch/musicsync/internal/secrets"
+	"golang.org/x/time/rate"
 )
 
-func SendAppleMusicAPIRequest[T any](client *http.Client, path string) (T, error) {
+// DefaultBaseURL is where Apple Music API requests are sent unless a client has its own BaseURL.
+const DefaultBaseURL = "https://api.music.apple.com"
+
+// Client sends requests to the Apple Music API. It is safe to share between goroutines. Create
+// clients with NewClient.
+type Client struct {
+	// BaseURL is the scheme and host requests are sent to, like DefaultBaseURL (which is used if
+	// it is empty).
+	BaseURL    string
+	httpClient *http.Client
+}
+
+// Options configures a client created with NewClient.
+type Options struct {
+	// Transport sends the requests once they've gone through the middleware.
+	// http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+	BaseURL   string
+	// Limiter is shared by every request the client sends. Requests aren't rate limited if it is
+	// nil.
+	Limiter *rate.Limiter
+	// Metrics records every request the client sends if it isn't nil.
+	Metrics *apis.Metrics
+	// Timeout is how long each attempt at a request can take. apis.DefaultTimeout is used if it
+	// is zero.
+	Timeout time.Duration
+}
+
+// NewClient creates a client whose requests are retried, authorized with the developer and user
+// tokens, rate limited, timed out, logged, and recorded, in that order.
+func NewClient(opts Options) *Client {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = apis.DefaultTimeout
+	}
+	return &Client{
+		BaseURL: opts.BaseURL,
+		httpClient: &http.Client{Transport: apis.Chain(
+			opts.Transport,
+			apis.Retry(apis.DefaultRetryPolicy, "apple music"),
+			apis.Auth(func(req *http.Request) error {
+				req.Header.Set("Authorization", "Bearer "+secrets.ENV.AppleMusicAppToken)
+				req.Header.Set("Music-User-Token", secrets.ENV.AppleMusicUserToken)
+				return nil
+			}),
+			apis.RateLimit(opts.Limiter),
+			apis.Timeout(timeout),
+			apis.Logging("apple music"),
+			apis.Instrument(opts.Metrics),
+		)},
+	}
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+type appleMusicRequest struct {
+	Method           string
+	Path             string
+	Body             io.Reader
+	NotExpectingJSON bool
+}
+
+func SendAppleMusicAPIRequest[T any](
+	ctx context.Context,
+	client *Client,
+	path string,
+) (T, error) {
+	return sendAppleMusicAPIRequest[T](
+		ctx,
+		client,
+		appleMusicRequest{Method: http.MethodGet, Path: path},
+	)
+}
+
+func sendAppleMusicAPIRequest[T any](
+	ctx context.Context,
+	client *Client,
+	request appleMusicRequest,
+) (T, error) {
 	var zeroValue T
-	req, err := http.NewRequest(
-		http.MethodGet,
-		fmt.Sprintf("https://api.music.apple.com/%s", strings.TrimLeft(path, "/")),
-		nil,
+	req, err := http.NewRequestWithContext(
+		ctx,
+		request.Method,
+		fmt.Sprintf("%s/%s", client.baseURL(), strings.TrimLeft(request.Path, "/")),
+		request.Body,
 	)
 	if err != nil {
 		return zeroValue, fmt.Errorf("%w failed to create request", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+secrets.ENV.AppleMusicAppToken)
-	req.Header.Set("Music-User-Token", secrets.ENV.AppleMusicUserToken)
+	if request.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	resp, err := apis.RequestJSON[T]("[apple music]", client, req, false)
+	resp, err := apis.RequestJSON[T](
+		"apple music",
+		client.httpClient,
+		req,
+		request.NotExpectingJSON,
+	)
 	if err != nil {
 		return zeroValue, fmt.Errorf("%w failed to make apple music API request", err)
 	}
@@ -1,8 +1,15 @@
 package applemusic
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+
+	"go.mattglei.ch/musicsync/internal/apis"
+	"go.mattglei.ch/musicsync/internal/utils"
 )
 
 type PlaylistResponse struct {
@@ -16,11 +23,38 @@ type PlaylistResponse struct {
 	Next string `json:"next"`
 }
 
-func PlaylistSongs(client *http.Client, id string) ([]string, error) {
+type libraryPlaylistResponse struct {
+	Data []struct {
+		Attributes struct {
+			LastModifiedDate string `json:"lastModifiedDate"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+type addTracksPayload struct {
+	Data []trackReference `json:"data"`
+}
+
+type trackReference struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// PlaylistSongs returns the catalog IDs of the songs in the library playlist, in order. Apple Music
+// responds to the songs of an empty playlist with a 404, so an empty list is returned if the
+// playlist itself exists.
+func PlaylistSongs(ctx context.Context, client *Client, id string) ([]string, error) {
 	path := fmt.Sprintf("/v1/me/library/playlists/%s/tracks", id)
 	ids := []string{}
 	for {
-		resp, err := SendAppleMusicAPIRequest[PlaylistResponse](client, path)
+		resp, err := SendAppleMusicAPIRequest[PlaylistResponse](ctx, client, path)
+		if len(ids) == 0 && apis.HasStatus(err, http.StatusNotFound) {
+			_, lastModifiedErr := PlaylistLastModified(ctx, client, id)
+			if lastModifiedErr != nil {
+				return []string{}, lastModifiedErr
+			}
+			return ids, nil
+		}
 		if err != nil {
 			return []string{}, fmt.Errorf(
 				"%w failed to get apply music playlist data for: %s",
@@ -39,3 +73,52 @@ func PlaylistSongs(client *http.Client, id string) ([]string, error) {
 	}
 	return ids, nil
 }
+
+// ErrPlaylistNotFound is returned when the library doesn't have a playlist with the given ID.
+var ErrPlaylistNotFound = errors.New("apple music playlist not found")
+
+// PlaylistLastModified returns when the library playlist was last modified. An empty string is
+// returned if Apple Music doesn't include it for the playlist.
+func PlaylistLastModified(ctx context.Context, client *Client, id string) (string, error) {
+	resp, err := SendAppleMusicAPIRequest[libraryPlaylistResponse](
+		ctx,
+		client,
+		fmt.Sprintf("/v1/me/library/playlists/%s", id),
+	)
+	if apis.HasStatus(err, http.StatusNotFound) {
+		return "", fmt.Errorf("%w with id of %s", ErrPlaylistNotFound, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w failed to get apple music playlist %s", err, id)
+	}
+	if len(resp.Data) == 0 {
+		return "", nil
+	}
+	return resp.Data[0].Attributes.LastModifiedDate, nil
+}
+
+// AddSongs appends the given catalog songs to the end of a library playlist.
+func AddSongs(ctx context.Context, client *Client, id string, songs []Song) error {
+	for _, batch := range utils.Batch(songs, 100) {
+		tracks := []trackReference{}
+		for _, song := range batch {
+			tracks = append(tracks, trackReference{ID: song.ID, Type: "songs"})
+		}
+
+		binary, err := json.Marshal(addTracksPayload{Data: tracks})
+		if err != nil {
+			return fmt.Errorf("%w failed to json marshal payload", err)
+		}
+
+		_, err = sendAppleMusicAPIRequest[any](ctx, client, appleMusicRequest{
+			Method:           http.MethodPost,
+			Path:             fmt.Sprintf("/v1/me/library/playlists/%s/tracks", id),
+			Body:             bytes.NewReader(binary),
+			NotExpectingJSON: true,
+		})
+		if err != nil {
+			return fmt.Errorf("%w failed to send apple music api request", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package applemusic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestPlaylistSongs(t *testing.T) {
+	const notFound = `{"errors": [{"status": "404", "title": "Resource Not Found"}]}`
+	tests := []struct {
+		name string
+		// pages are the songs in each page of the playlist. Nil means the playlist has no songs.
+		pages   [][]string
+		exists  bool
+		want    []string
+		wantErr error
+	}{
+		{
+			name:   "pages",
+			pages:  [][]string{{"1", "2"}, {"3"}},
+			exists: true,
+			want:   []string{"1", "2", "3"},
+		},
+		{name: "empty playlist", exists: true, want: []string{}},
+		{name: "missing playlist", wantErr: ErrPlaylistNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(
+				"GET /v1/me/library/playlists/p.test",
+				func(w http.ResponseWriter, _ *http.Request) {
+					if !test.exists {
+						w.WriteHeader(http.StatusNotFound)
+						_, _ = fmt.Fprint(w, notFound)
+						return
+					}
+					_, _ = fmt.Fprint(
+						w,
+						`{"data": [{"attributes": {"lastModifiedDate": "2026-03-10"}}]}`,
+					)
+				},
+			)
+			mux.HandleFunc(
+				"GET /v1/me/library/playlists/p.test/tracks",
+				func(w http.ResponseWriter, r *http.Request) {
+					if len(test.pages) == 0 {
+						w.WriteHeader(http.StatusNotFound)
+						_, _ = fmt.Fprint(w, notFound)
+						return
+					}
+					page := 0
+					_, _ = fmt.Sscan(r.URL.Query().Get("page"), &page)
+					data := ""
+					for i, id := range test.pages[page] {
+						if i != 0 {
+							data += ","
+						}
+						data += fmt.Sprintf(`{"attributes": {"playParams": {"reportingId": %q}}}`, id)
+					}
+					next := ""
+					if page+1 < len(test.pages) {
+						next = fmt.Sprintf("/v1/me/library/playlists/p.test/tracks?page=%d", page+1)
+					}
+					_, _ = fmt.Fprintf(w, `{"data": [%s], "next": %q}`, data, next)
+				},
+			)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			ids, err := PlaylistSongs(t.Context(), NewClient(Options{BaseURL: server.URL}), "p.test")
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("PlaylistSongs() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr == nil && !slices.Equal(ids, test.want) {
+				t.Errorf("PlaylistSongs() = %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
@@ -1,33 +1,68 @@
 package applemusic
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"go.mattglei.ch/musicsync/internal/match"
 	"go.mattglei.ch/musicsync/internal/utils"
 )
 
 type Song struct {
-	Name   string `json:"name"`
-	ISRC   string `json:"isrc"`
-	Artist string `json:"artistName"`
+	ID             string `json:"-"`
+	Name           string `json:"name"`
+	ISRC           string `json:"isrc"`
+	Artist         string `json:"artistName"`
+	Album          string `json:"albumName"`
+	DurationMillis int    `json:"durationInMillis"`
+	ContentRating  string `json:"contentRating"`
 }
 
 type CatalogSongsResponse struct {
 	Data []struct {
+		ID         string `json:"id"`
 		Attributes Song
 	}
 }
 
-func PlaylistISRCs(client *http.Client, ids []string) ([]Song, error) {
-	groups := utils.Batch(ids, 300)
-	songs := []Song{}
-	for _, group := range groups {
-		ids := strings.Join(group, ",")
-		params := url.Values{"ids": {ids}}
+// Candidate describes the song for scoring search results against it.
+func (s Song) Candidate() match.Candidate {
+	return match.Candidate{
+		ISRC:     s.ISRC,
+		Name:     s.Name,
+		Artist:   s.Artist,
+		Album:    s.Album,
+		Duration: time.Duration(s.DurationMillis) * time.Millisecond,
+		Explicit: s.ContentRating == "explicit",
+	}
+}
+
+// PlaylistISRCs looks up the catalog songs with the given IDs. The songs are returned in the
+// order of ids, including any IDs that are in it more than once, and songs that aren't in the
+// catalog are left out.
+func PlaylistISRCs(ctx context.Context, client *Client, ids []string) ([]Song, error) {
+	// the catalog only returns each song once, so each id is only requested once
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	byID := map[string]Song{}
+	for _, group := range utils.Batch(unique, 300) {
+		if len(group) == 0 {
+			continue
+		}
+		joined := strings.Join(group, ",")
+		params := url.Values{"ids": {joined}}
 		searchedSongs, err := SendAppleMusicAPIRequest[CatalogSongsResponse](
+			ctx,
 			client,
 			fmt.Sprintf("/v1/catalog/us/songs?%s", params.Encode()),
 		)
@@ -35,13 +70,40 @@ func PlaylistISRCs(client *http.Client, ids []string) ([]Song, error) {
 			return []Song{}, fmt.Errorf(
 				"%w failed to get catalog data for following ids: %s",
 				err,
-				ids,
+				joined,
 			)
 		}
 		for _, song := range searchedSongs.Data {
-			songs = append(songs, song.Attributes)
+			song.Attributes.ID = song.ID
+			byID[song.ID] = song.Attributes
 		}
 	}
 
+	songs := make([]Song, 0, len(ids))
+	for _, id := range ids {
+		if song, ok := byID[id]; ok {
+			songs = append(songs, song)
+		}
+	}
+	return songs, nil
+}
+
+// SearchISRC looks up the songs in the Apple Music catalog with the given ISRC.
+func SearchISRC(ctx context.Context, client *Client, isrc string) ([]Song, error) {
+	params := url.Values{"filter[isrc]": {isrc}}
+	resp, err := SendAppleMusicAPIRequest[CatalogSongsResponse](
+		ctx,
+		client,
+		fmt.Sprintf("/v1/catalog/us/songs?%s", params.Encode()),
+	)
+	if err != nil {
+		return []Song{}, fmt.Errorf("%w failed to search catalog for isrc of %s", err, isrc)
+	}
+
+	songs := []Song{}
+	for _, song := range resp.Data {
+		song.Attributes.ID = song.ID
+		songs = append(songs, song.Attributes)
+	}
 	return songs, nil
 }
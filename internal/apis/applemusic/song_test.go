@@ -0,0 +1,51 @@
+package applemusic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlaylistISRCsKeepsDuplicatesAndOrder(t *testing.T) {
+	var requested [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		requested = append(requested, ids)
+		// the catalog returns each song once, in its own order, and leaves out unknown songs
+		data := []string{}
+		for _, id := range slices.Backward(ids) {
+			if id != "missing" {
+				data = append(data, fmt.Sprintf(
+					`{"id": %q, "attributes": {"name": "Song %s", "isrc": "ISRC%s"}}`,
+					id, id, id,
+				))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"data": [%s]}`, strings.Join(data, ","))
+	}))
+	defer server.Close()
+	client := NewClient(Options{BaseURL: server.URL})
+
+	songs, err := PlaylistISRCs(t.Context(), client, []string{"1", "2", "missing", "1", "3", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, song := range songs {
+		ids = append(ids, song.ID)
+	}
+	if want := []string{"1", "2", "1", "3", "2"}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+	if songs[2].ISRC != "ISRC1" {
+		t.Errorf("isrc of the duplicate = %q, want ISRC1", songs[2].ISRC)
+	}
+	if want := [][]string{{"1", "2", "missing", "3"}}; len(requested) != 1 ||
+		!slices.Equal(requested[0], want[0]) {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+}
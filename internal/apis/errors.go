@@ -0,0 +1,104 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StatusError is a non-2xx response from an API. Message is the error message from the body of the
+// response when it could be parsed as a Spotify or Apple Music error, and Body is the raw body.
+// Retryable is set for responses that could succeed if the request is sent again (rate limits and
+// server errors), which Request already retried before giving up.
+type StatusError struct {
+	Provider   string
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+	Body       []byte
+	Retryable  bool
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf(
+		"[%s] %s %s returned %d (%s)",
+		e.Provider,
+		e.Method,
+		e.URL,
+		e.StatusCode,
+		strings.ToLower(http.StatusText(e.StatusCode)),
+	)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is makes retryable status errors match ErrWarning since they are caused by transient conditions
+// outside of our control.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrWarning && e.Retryable
+}
+
+// HasStatus reports if err is a StatusError with one of the given status codes.
+func HasStatus(err error, statusCodes ...int) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	for _, code := range statusCodes {
+		if statusErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// errorMessage parses the error message out of the body of a Spotify or Apple Music error
+// response. An empty string is returned if the body isn't in any of their formats.
+func errorMessage(body []byte) string {
+	// spotify's web api: {"error": {"status": 404, "message": "..."}}
+	var spotifyErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &spotifyErr) == nil && spotifyErr.Error.Message != "" {
+		return spotifyErr.Error.Message
+	}
+
+	// spotify's accounts service: {"error": "invalid_grant", "error_description": "..."}
+	var oauthErr struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+		if oauthErr.Description == "" {
+			return oauthErr.Error
+		}
+		return oauthErr.Error + ": " + oauthErr.Description
+	}
+
+	// apple music: {"errors": [{"title": "...", "detail": "..."}]}
+	var appleMusicErr struct {
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &appleMusicErr) == nil && len(appleMusicErr.Errors) != 0 {
+		messages := make([]string, 0, len(appleMusicErr.Errors))
+		for _, e := range appleMusicErr.Errors {
+			message := e.Title
+			if e.Detail != "" {
+				message += ": " + e.Detail
+			}
+			messages = append(messages, message)
+		}
+		return strings.Join(messages, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	err := &StatusError{
+		Provider:   "spotify",
+		Method:     http.MethodGet,
+		URL:        "https://api.spotify.com/v1/playlists/missing",
+		StatusCode: http.StatusNotFound,
+		Message:    "Resource not found",
+	}
+	want := "[spotify] GET https://api.spotify.com/v1/playlists/missing returned 404 (not found): " +
+		"Resource not found"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	err.Message = ""
+	want = "[spotify] GET https://api.spotify.com/v1/playlists/missing returned 404 (not found)"
+	if err.Error() != want {
+		t.Errorf("Error() without a message = %q, want %q", err.Error(), want)
+	}
+
+	wrapped := fmt.Errorf("%w failed to get playlist", err)
+	if !HasStatus(wrapped, http.StatusBadRequest, http.StatusNotFound) {
+		t.Error("HasStatus() = false for a wrapped 404")
+	}
+	if HasStatus(wrapped, http.StatusBadRequest) {
+		t.Error("HasStatus() = true for another status code")
+	}
+	if HasStatus(errors.New("not a status error"), http.StatusNotFound) {
+		t.Error("HasStatus() = true for another error")
+	}
+
+	if errors.Is(wrapped, ErrWarning) {
+		t.Error("a 404 is a warning")
+	}
+	err.Retryable = true
+	if !errors.Is(wrapped, ErrWarning) {
+		t.Error("a retryable status error isn't a warning")
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "spotify",
+			body: `{"error": {"status": 404, "message": "Resource not found"}}`,
+			want: "Resource not found",
+		},
+		{
+			name: "oauth",
+			body: `{"error": "invalid_grant", "error_description": "Invalid refresh token"}`,
+			want: "invalid_grant: Invalid refresh token",
+		},
+		{
+			name: "oauth without a description",
+			body: `{"error": "invalid_client"}`,
+			want: "invalid_client",
+		},
+		{
+			name: "apple music",
+			body: `{"errors": [{"title": "Unauthorized", "detail": "Invalid token"}, ` +
+				`{"title": "Forbidden"}]}`,
+			want: "Unauthorized: Invalid token, Forbidden",
+		},
+		{name: "apple music without errors", body: `{"errors": []}`, want: ""},
+		{name: "html", body: "<html>Bad Gateway</html>", want: ""},
+		{name: "empty", body: "", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := errorMessage([]byte(test.body)); got != test.want {
+				t.Errorf("errorMessage() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
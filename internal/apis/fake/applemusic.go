@@ -0,0 +1,264 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+)
+
+// Song is a song in the fake Apple Music catalog.
+type Song struct {
+	ID             string
+	ISRC           string
+	Name           string
+	Artist         string
+	Album          string
+	DurationMillis int
+	ContentRating  string
+}
+
+// AppleMusic is a fake of the Apple Music API with a catalog and a library of playlists. The
+// developer and user tokens aren't checked.
+type AppleMusic struct {
+	// URL is where the fake is served.
+	URL string
+	// PageSize is the most songs in a page of a playlist.
+	PageSize int
+
+	server    *httptest.Server
+	mutex     sync.Mutex
+	requests  map[string]int
+	songs     map[string]Song
+	playlists map[string]*appleMusicPlaylist
+}
+
+type appleMusicPlaylist struct {
+	songIDs      []string
+	lastModified time.Time
+}
+
+// NewAppleMusic starts a fake Apple Music. Call Close when done with it.
+func NewAppleMusic() *AppleMusic {
+	a := &AppleMusic{
+		PageSize:  DefaultPageSize,
+		requests:  map[string]int{},
+		songs:     map[string]Song{},
+		playlists: map[string]*appleMusicPlaylist{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/me/library/playlists/{id}", a.locked(a.playlist))
+	mux.HandleFunc("GET /v1/me/library/playlists/{id}/tracks", a.locked(a.playlistTracks))
+	mux.HandleFunc("POST /v1/me/library/playlists/{id}/tracks", a.locked(a.addTracks))
+	mux.HandleFunc("GET /v1/catalog/{storefront}/songs", a.locked(a.catalogSongs))
+	a.server = httptest.NewServer(mux)
+	a.URL = a.server.URL
+	return a
+}
+
+// Client creates an Apple Music client that sends its requests to the fake.
+func (a *AppleMusic) Client() *applemusic.Client {
+	return applemusic.NewClient(applemusic.Options{
+		Transport: a.server.Client().Transport,
+		BaseURL:   a.URL,
+	})
+}
+
+// Close shuts down the fake.
+func (a *AppleMusic) Close() {
+	a.server.Close()
+}
+
+// AddSongs adds songs to the catalog so they can be looked up and added to playlists.
+func (a *AppleMusic) AddSongs(songs ...Song) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, song := range songs {
+		a.songs[song.ID] = song
+	}
+}
+
+// SetPlaylist creates or replaces a library playlist with the catalog songs with the given IDs, in
+// order.
+func (a *AppleMusic) SetPlaylist(id string, songIDs ...string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.playlists[id] = &appleMusicPlaylist{songIDs: slices.Clone(songIDs), lastModified: time.Now()}
+}
+
+// Playlist returns the IDs of the songs in a library playlist, in order.
+func (a *AppleMusic) Playlist(id string) ([]string, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	playlist, ok := a.playlists[id]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(playlist.songIDs), true
+}
+
+// Requests is how many requests were sent to the route with the pattern, like
+// "GET /v1/catalog/{storefront}/songs".
+func (a *AppleMusic) Requests(pattern string) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.requests[pattern]
+}
+
+// locked calls handler with the mutex held.
+func (a *AppleMusic) locked(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.requests[r.Pattern]++
+		handler(w, r)
+	}
+}
+
+func (a *AppleMusic) findPlaylist(
+	w http.ResponseWriter,
+	r *http.Request,
+) (*appleMusicPlaylist, bool) {
+	playlist, ok := a.playlists[r.PathValue("id")]
+	if !ok {
+		appleMusicError(w, http.StatusNotFound, "Resource Not Found")
+	}
+	return playlist, ok
+}
+
+func (a *AppleMusic) playlist(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := a.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": []map[string]any{{
+			"id":   r.PathValue("id"),
+			"type": "library-playlists",
+			"attributes": map[string]any{
+				"lastModifiedDate": playlist.lastModified.UTC().Format(time.RFC3339Nano),
+			},
+		}},
+	})
+}
+
+// playlistTracks pages through the songs in a playlist. Like the real API, an empty playlist is a
+// 404 instead of an empty page.
+func (a *AppleMusic) playlistTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := a.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	if len(playlist.songIDs) == 0 {
+		appleMusicError(w, http.StatusNotFound, "Resource Not Found")
+		return
+	}
+	start, end, next := page(r, len(playlist.songIDs), a.PageSize)
+	data := []map[string]any{}
+	for _, id := range playlist.songIDs[start:end] {
+		song := a.songs[id]
+		data = append(data, map[string]any{
+			"id":   "i." + id,
+			"type": "library-songs",
+			"attributes": map[string]any{
+				"name":       song.Name,
+				"artistName": song.Artist,
+				"playParams": map[string]any{"id": "i." + id, "reportingId": id},
+			},
+		})
+	}
+	resp := map[string]any{"data": data, "meta": map[string]int{"total": len(playlist.songIDs)}}
+	if next != -1 {
+		resp["next"] = fmt.Sprintf(
+			"/v1/me/library/playlists/%s/tracks?offset=%d",
+			r.PathValue("id"),
+			next,
+		)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *AppleMusic) addTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := a.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Data []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	ids := []string{}
+	for _, track := range body.Data {
+		if _, ok := a.songs[track.ID]; !ok || track.Type != "songs" {
+			appleMusicError(w, http.StatusBadRequest, "Invalid track "+track.ID)
+			return
+		}
+		ids = append(ids, track.ID)
+	}
+	playlist.songIDs = append(playlist.songIDs, ids...)
+	playlist.lastModified = time.Now()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// catalogSongs looks up songs by their IDs or filters them by ISRC.
+func (a *AppleMusic) catalogSongs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	songs := []Song{}
+	switch {
+	case query.Has("ids"):
+		for id := range strings.SplitSeq(query.Get("ids"), ",") {
+			if song, ok := a.songs[id]; ok {
+				songs = append(songs, song)
+			}
+		}
+	case query.Has("filter[isrc]"):
+		for _, song := range a.songs {
+			if strings.EqualFold(song.ISRC, query.Get("filter[isrc]")) {
+				songs = append(songs, song)
+			}
+		}
+		// the catalog is a map, so results are sorted to be the same every time
+		slices.SortFunc(songs, func(a, b Song) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+	default:
+		appleMusicError(w, http.StatusBadRequest, "Missing ids or filter")
+		return
+	}
+
+	data := []map[string]any{}
+	for _, song := range songs {
+		data = append(data, map[string]any{
+			"id":   song.ID,
+			"type": "songs",
+			"attributes": map[string]any{
+				"name":             song.Name,
+				"isrc":             song.ISRC,
+				"artistName":       song.Artist,
+				"albumName":        song.Album,
+				"durationInMillis": song.DurationMillis,
+				"contentRating":    song.ContentRating,
+			},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+func appleMusicError(w http.ResponseWriter, status int, title string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{
+			"status": fmt.Sprint(status),
+			"title":  title,
+		}},
+	})
+}
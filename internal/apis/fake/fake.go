@@ -0,0 +1,46 @@
+// Package fake has in-memory fakes of the Spotify and Apple Music APIs, served over HTTP with
+// httptest, so that the API clients and whole syncs can be run without the real services. The
+// fakes only model what musicsync uses: playlists with pagination and snapshot IDs, searching,
+// catalog lookups, and refreshing Spotify access tokens.
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// DefaultPageSize is how many songs a page of a playlist has unless the request asks for fewer.
+const DefaultPageSize = 100
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	err := json.NewDecoder(r.Body).Decode(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// page returns the range of a list of length n that the offset and limit query parameters of the
+// request ask for, and the offset of the next page or -1 if it is the last page.
+func page(r *http.Request, n int, pageSize int) (start int, end int, next int) {
+	query := r.URL.Query()
+	start, _ = strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || limit > pageSize {
+		limit = pageSize
+	}
+	start = min(max(start, 0), n)
+	end = min(start+limit, n)
+	if end == n {
+		return start, end, -1
+	}
+	return start, end, end
+}
@@ -0,0 +1,464 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+// Track is a song in the fake Spotify catalog.
+type Track struct {
+	ID             string
+	ISRC           string
+	Name           string
+	Artists        []string
+	Album          string
+	DurationMillis int
+	Explicit       bool
+}
+
+// Spotify is a fake of the Spotify Web API and accounts service. Requests need the access token
+// from the last token refresh, which needs the refresh token the fake was created with.
+type Spotify struct {
+	// URL is where the fake is served for both API requests and token refreshes.
+	URL string
+	// PageSize is the most songs in a page of a playlist.
+	PageSize int
+
+	server       *httptest.Server
+	mutex        sync.Mutex
+	refreshToken string
+	accessToken  string
+	refreshes    int
+	requests     map[string]int
+	tracks       map[string]Track
+	playlists    map[string]*spotifyPlaylist
+	snapshots    int
+}
+
+type spotifyPlaylist struct {
+	description string
+	snapshotID  string
+	trackIDs    []string
+}
+
+// NewSpotify starts a fake Spotify that accepts refreshToken. Call Close when done with it.
+func NewSpotify(refreshToken string) *Spotify {
+	s := &Spotify{
+		PageSize:     DefaultPageSize,
+		refreshToken: refreshToken,
+		requests:     map[string]int{},
+		tracks:       map[string]Track{},
+		playlists:    map[string]*spotifyPlaylist{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", s.token)
+	mux.HandleFunc("GET /v1/playlists/{id}", s.authorized(s.playlist))
+	mux.HandleFunc("PUT /v1/playlists/{id}", s.authorized(s.updatePlaylist))
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", s.authorized(s.playlistTracks))
+	mux.HandleFunc("POST /v1/playlists/{id}/tracks", s.authorized(s.addTracks))
+	mux.HandleFunc("PUT /v1/playlists/{id}/tracks", s.authorized(s.replaceOrReorderTracks))
+	mux.HandleFunc("DELETE /v1/playlists/{id}/tracks", s.authorized(s.removeTracks))
+	mux.HandleFunc("GET /v1/tracks/{id}", s.authorized(s.track))
+	mux.HandleFunc("GET /v1/search", s.authorized(s.search))
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	return s
+}
+
+// Client creates a Spotify client that sends its requests to the fake. It still needs to be
+// authorized.
+func (s *Spotify) Client() *spotify.Client {
+	return spotify.NewClient(spotify.Options{
+		Transport:    s.server.Client().Transport,
+		RefreshToken: s.refreshToken,
+		BaseURL:      s.URL,
+		AccountsURL:  s.URL,
+	})
+}
+
+// Close shuts down the fake.
+func (s *Spotify) Close() {
+	s.server.Close()
+}
+
+// AddTracks adds tracks to the catalog so they can be searched for and added to playlists.
+func (s *Spotify) AddTracks(tracks ...Track) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, track := range tracks {
+		s.tracks[track.ID] = track
+	}
+}
+
+// SetPlaylist creates or replaces a playlist with the tracks with the given IDs, in order.
+func (s *Spotify) SetPlaylist(id string, trackIDs ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	playlist := &spotifyPlaylist{}
+	s.playlists[id] = playlist
+	s.changed(playlist, slices.Clone(trackIDs))
+}
+
+// Playlist returns the IDs of the tracks in a playlist, in order, and its description.
+func (s *Spotify) Playlist(id string) ([]string, string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return nil, "", false
+	}
+	return slices.Clone(playlist.trackIDs), playlist.description, true
+}
+
+// Refreshes is how many times the access token has been refreshed.
+func (s *Spotify) Refreshes() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refreshes
+}
+
+// Requests is how many authorized requests were sent to the route with the pattern, like
+// "GET /v1/search".
+func (s *Spotify) Requests(pattern string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[pattern]
+}
+
+// ExpireToken makes the current access token invalid so the next request has to refresh it.
+func (s *Spotify) ExpireToken() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accessToken = ""
+}
+
+// changed sets the tracks of a playlist and gives it a new snapshot ID. The mutex must be held.
+func (s *Spotify) changed(playlist *spotifyPlaylist, trackIDs []string) {
+	s.snapshots++
+	playlist.snapshotID = "snapshot-" + strconv.Itoa(s.snapshots)
+	playlist.trackIDs = trackIDs
+}
+
+func (s *Spotify) token(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the real accounts service takes the parameters from either the query or the form
+	refreshToken := r.URL.Query().Get("refresh_token")
+	if refreshToken == "" {
+		refreshToken = r.PostFormValue("refresh_token")
+	}
+	if refreshToken != s.refreshToken {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_grant",
+			"error_description": "Invalid refresh token",
+		})
+		return
+	}
+	s.refreshes++
+	s.accessToken = "access-" + strconv.Itoa(s.refreshes)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": s.accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Hour.Seconds()),
+	})
+}
+
+// authorized only calls handler for requests with the current access token, with the mutex held.
+func (s *Spotify) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.accessToken == "" || r.Header.Get("Authorization") != "Bearer "+s.accessToken {
+			spotifyError(w, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		s.requests[r.Pattern]++
+		handler(w, r)
+	}
+}
+
+func (s *Spotify) findPlaylist(w http.ResponseWriter, r *http.Request) (*spotifyPlaylist, bool) {
+	playlist, ok := s.playlists[r.PathValue("id")]
+	if !ok {
+		spotifyError(w, http.StatusNotFound, "Resource not found")
+	}
+	return playlist, ok
+}
+
+func (s *Spotify) playlist(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":          r.PathValue("id"),
+		"description": playlist.description,
+		"snapshot_id": playlist.snapshotID,
+	})
+}
+
+func (s *Spotify) updatePlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Description *string `json:"description"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Description != nil {
+		playlist.description = *body.Description
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Spotify) playlistTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	start, end, next := page(r, len(playlist.trackIDs), s.PageSize)
+	items := []map[string]any{}
+	for _, id := range playlist.trackIDs[start:end] {
+		items = append(items, map[string]any{"track": s.trackJSON(s.tracks[id])})
+	}
+	nextURL := ""
+	if next != -1 {
+		nextURL = fmt.Sprintf(
+			"%s/v1/playlists/%s/tracks?offset=%d&limit=%d",
+			s.URL,
+			r.PathValue("id"),
+			next,
+			end-start,
+		)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":  items,
+		"next":   nextURL,
+		"offset": start,
+		"total":  len(playlist.trackIDs),
+	})
+}
+
+func (s *Spotify) addTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		URIs []string `json:"uris"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	ids, ok := s.trackIDs(w, body.URIs)
+	if !ok {
+		return
+	}
+	s.changed(playlist, append(slices.Clone(playlist.trackIDs), ids...))
+	writeJSON(w, http.StatusCreated, map[string]string{"snapshot_id": playlist.snapshotID})
+}
+
+// replaceOrReorderTracks replaces the tracks of the playlist if the body has uris and otherwise
+// moves a range of tracks, like the real endpoint.
+func (s *Spotify) replaceOrReorderTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		URIs         []string `json:"uris"`
+		RangeStart   int      `json:"range_start"`
+		InsertBefore int      `json:"insert_before"`
+		RangeLength  int      `json:"range_length"`
+		SnapshotID   string   `json:"snapshot_id"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	if body.URIs != nil {
+		ids, ok := s.trackIDs(w, body.URIs)
+		if !ok {
+			return
+		}
+		s.changed(playlist, ids)
+		writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": playlist.snapshotID})
+		return
+	}
+
+	if body.SnapshotID != "" && body.SnapshotID != playlist.snapshotID {
+		spotifyError(w, http.StatusBadRequest, "Snapshot id is not the latest version")
+		return
+	}
+	length := max(body.RangeLength, 1)
+	n := len(playlist.trackIDs)
+	if body.RangeStart < 0 || body.RangeStart+length > n || body.InsertBefore < 0 ||
+		body.InsertBefore > n {
+		spotifyError(w, http.StatusBadRequest, "Index out of bounds")
+		return
+	}
+	moved := slices.Clone(playlist.trackIDs[body.RangeStart : body.RangeStart+length])
+	rest := slices.Delete(slices.Clone(playlist.trackIDs), body.RangeStart, body.RangeStart+length)
+	insertBefore := body.InsertBefore
+	if insertBefore > body.RangeStart {
+		insertBefore -= length
+	}
+	s.changed(playlist, slices.Insert(rest, insertBefore, moved...))
+	writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": playlist.snapshotID})
+}
+
+// removeTracks removes tracks at their positions in the playlist, or every copy of the tracks if no
+// positions are given. The real API finds where the tracks moved to if the snapshot ID is for an
+// older version of the playlist, but the fake refuses it so that removals are always made against
+// the latest version.
+func (s *Spotify) removeTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.findPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Tracks []struct {
+			URI       string `json:"uri"`
+			Positions []int  `json:"positions"`
+		} `json:"tracks"`
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.SnapshotID != "" && body.SnapshotID != playlist.snapshotID {
+		spotifyError(w, http.StatusBadRequest, "Snapshot id is not the latest version")
+		return
+	}
+
+	version := playlist.trackIDs
+	positions := map[int]bool{}
+	all := map[string]bool{}
+	for _, track := range body.Tracks {
+		id := strings.TrimPrefix(track.URI, "spotify:track:")
+		if len(track.Positions) == 0 {
+			all[id] = true
+			continue
+		}
+		for _, position := range track.Positions {
+			if position < 0 || position >= len(version) || version[position] != id {
+				spotifyError(w, http.StatusBadRequest, "Track not at position")
+				return
+			}
+			positions[position] = true
+		}
+	}
+	ids := []string{}
+	for i, id := range playlist.trackIDs {
+		if !all[id] && !positions[i] {
+			ids = append(ids, id)
+		}
+	}
+	s.changed(playlist, ids)
+	writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": playlist.snapshotID})
+}
+
+func (s *Spotify) track(w http.ResponseWriter, r *http.Request) {
+	track, ok := s.tracks[r.PathValue("id")]
+	if !ok {
+		spotifyError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.trackJSON(track))
+}
+
+var (
+	isrcQuery = regexp.MustCompile(`^isrc:(\S+)$`)
+	nameQuery = regexp.MustCompile(`^track:"([^"]*)" artist:"([^"]*)"$`)
+)
+
+// search supports the isrc and name and artist queries that musicsync makes. Names and artists
+// match if they contain the query, ignoring case.
+func (s *Spotify) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	var keep func(track Track) bool
+	if match := isrcQuery.FindStringSubmatch(query.Get("q")); match != nil {
+		keep = func(track Track) bool {
+			return strings.EqualFold(track.ISRC, match[1])
+		}
+	} else if match := nameQuery.FindStringSubmatch(query.Get("q")); match != nil {
+		name, artist := strings.ToLower(match[1]), strings.ToLower(match[2])
+		keep = func(track Track) bool {
+			return strings.Contains(strings.ToLower(track.Name), name) &&
+				slices.ContainsFunc(track.Artists, func(a string) bool {
+					return strings.Contains(strings.ToLower(a), artist)
+				})
+		}
+	} else {
+		spotifyError(w, http.StatusBadRequest, "Unsupported query")
+		return
+	}
+
+	ids := []string{}
+	for id, track := range s.tracks {
+		if keep(track) {
+			ids = append(ids, id)
+		}
+	}
+	// the catalog is a map, so results are sorted to be the same every time
+	slices.Sort(ids)
+	items := []map[string]any{}
+	for _, id := range ids[:min(limit, len(ids))] {
+		items = append(items, s.trackJSON(s.tracks[id]))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tracks": map[string]any{"items": items}})
+}
+
+// trackIDs converts track URIs to IDs, failing if any of them aren't in the catalog.
+func (s *Spotify) trackIDs(w http.ResponseWriter, uris []string) ([]string, bool) {
+	ids := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		id := strings.TrimPrefix(uri, "spotify:track:")
+		if _, ok := s.tracks[id]; !ok {
+			spotifyError(w, http.StatusBadRequest, "Invalid track uri: "+uri)
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+func (s *Spotify) trackJSON(track Track) map[string]any {
+	artists := []map[string]string{}
+	for _, artist := range track.Artists {
+		artists = append(artists, map[string]string{"name": artist})
+	}
+	return map[string]any{
+		"id":           track.ID,
+		"name":         track.Name,
+		"artists":      artists,
+		"album":        map[string]string{"name": track.Album},
+		"duration_ms":  track.DurationMillis,
+		"explicit":     track.Explicit,
+		"external_ids": map[string]string{"isrc": track.ISRC},
+	}
+}
+
+func spotifyError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"status": status, "message": message},
+	})
+}
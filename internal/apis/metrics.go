@@ -0,0 +1,56 @@
+package apis
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics counts the requests sent to an API along with their status codes and how long they
+// took. It is safe to share between goroutines.
+type Metrics struct {
+	mutex    sync.Mutex
+	requests int
+	failures int
+	statuses map[int]int
+	duration time.Duration
+}
+
+func (m *Metrics) record(statusCode int, took time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests++
+	m.duration += took
+	if statusCode == 0 {
+		m.failures++
+		return
+	}
+	if m.statuses == nil {
+		m.statuses = map[int]int{}
+	}
+	m.statuses[statusCode]++
+}
+
+// Summary describes the requests recorded so far, like "12 requests (200: 10, 429: 2), 0 failed,
+// 150ms on average".
+func (m *Metrics) Summary() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.requests == 0 {
+		return "0 requests"
+	}
+	statuses := []string{}
+	for _, code := range slices.Sorted(maps.Keys(m.statuses)) {
+		statuses = append(statuses, fmt.Sprintf("%d: %d", code, m.statuses[code]))
+	}
+	return fmt.Sprintf(
+		"%d requests (%s), %d failed, %s on average",
+		m.requests,
+		strings.Join(statuses, ", "),
+		m.failures,
+		(m.duration / time.Duration(m.requests)).Round(time.Millisecond),
+	)
+}
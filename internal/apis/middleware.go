@@ -0,0 +1,208 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mattglei.ch/timber"
+	"golang.org/x/time/rate"
+)
+
+// DefaultTimeout is how long each attempt at a request can take, including reading the body of
+// the response.
+const DefaultTimeout = 20 * time.Second
+
+// Middleware wraps a transport to do something before or after every request it sends.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is a function that sends requests.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base in the middleware. The first middleware is the outermost one, so it sees each
+// request first and each response last. http.DefaultTransport is used if base is nil.
+func Chain(base http.RoundTripper, middleware ...Middleware) http.RoundTripper {
+	transport := base
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// Timeout limits how long each request can take. The response body has to be read before the
+// timeout too since the request is canceled once the body is closed.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		})
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Retry resends requests that fail according to the policy (see RetryPolicy). The response or
+// error of the last attempt is returned. Waiting to retry stops early if the context of the
+// request is canceled. Requests that aren't idempotent, like POST requests, could be applied twice
+// if they are sent again so they are only retried if they were rate limited or the connection
+// failed before they were sent. Requests with a body that can't be read again (see
+// http.Request.GetBody) are never retried.
+func Retry(policy RetryPolicy, provider string) Middleware {
+	logPrefix := "[" + provider + "]"
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var (
+				ctx        = req.Context()
+				repeatable = idempotent(req.Method)
+				resendable = req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+			)
+			for retries := 0; ; retries++ {
+				attempt := req
+				if retries != 0 && req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, fmt.Errorf("%w failed to reset request body for retry", err)
+					}
+					attempt = req.Clone(ctx)
+					attempt.Body = body
+				}
+
+				var (
+					delay     time.Duration
+					resp, err = next.RoundTrip(attempt)
+					giveUp    = !resendable || retries >= policy.MaxRetries
+				)
+				if err != nil {
+					_, ok := temporary(err)
+					ok = (ok && repeatable) || notSent(err)
+					if !ok || ctx.Err() != nil || giveUp {
+						return nil, err
+					}
+					delay = policy.backoff(retries)
+				} else {
+					var ok bool
+					delay, ok = policy.statusDelay(resp, retries, time.Now())
+					ok = ok && (repeatable || resp.StatusCode == http.StatusTooManyRequests)
+					if !ok || giveUp {
+						return resp, nil
+					}
+					// the body is drained so the connection can be reused for the retry
+					_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+					_ = resp.Body.Close()
+				}
+
+				timber.Warning(logPrefix, "retrying request in", delay.Round(time.Millisecond))
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil, fmt.Errorf(
+						"%w waiting to retry request to %s",
+						ctx.Err(),
+						req.URL.String(),
+					)
+				}
+			}
+		})
+	}
+}
+
+// RateLimit waits for the limiter before sending each request (see RateLimitedTransport). A nil
+// limiter doesn't limit anything.
+func RateLimit(limiter *rate.Limiter) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if limiter == nil {
+			return next
+		}
+		return RateLimitedTransport{Limiter: limiter, Base: next}
+	}
+}
+
+// Logging logs a warning for every request that fails with a network error or a non-2xx response.
+func Logging(provider string) Middleware {
+	logPrefix := "[" + provider + "]"
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			switch {
+			case err != nil:
+				if description, ok := temporary(err); ok {
+					timber.Warning(logPrefix, description, req.URL.Path)
+				} else if req.Context().Err() == nil {
+					timber.Warning(logPrefix, "request to", req.URL.Path, "failed:", err.Error())
+				}
+			case resp.StatusCode < 200 || resp.StatusCode >= 300:
+				timber.Warning(
+					logPrefix,
+					resp.StatusCode,
+					fmt.Sprintf("(%s)", strings.ToLower(http.StatusText(resp.StatusCode))),
+					"to",
+					req.URL.String(),
+				)
+			}
+			return resp, err
+		})
+	}
+}
+
+// Instrument records every request in metrics. Nil metrics don't record anything.
+func Instrument(metrics *Metrics) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if metrics == nil {
+			return next
+		}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			statusCode := 0
+			if err == nil {
+				statusCode = resp.StatusCode
+			}
+			metrics.record(statusCode, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Auth sets the authorization headers of each request with set. The request passed to set is a
+// copy so it can be changed.
+func Auth(set func(req *http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			authorized := req.Clone(req.Context())
+			err := set(authorized)
+			if err != nil {
+				if req.Body != nil {
+					_ = req.Body.Close()
+				}
+				return nil, fmt.Errorf("%w failed to authorize request", err)
+			}
+			return next.RoundTrip(authorized)
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok responds to every request with an empty 200 response.
+var ok = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+})
+
+func TestChain(t *testing.T) {
+	calls := []string{}
+	record := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" request")
+				resp, err := next.RoundTrip(req)
+				calls = append(calls, name+" response")
+				return resp, err
+			})
+		}
+	}
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls = append(calls, "base")
+		return ok(req)
+	})
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Chain(base, record("outer"), record("inner")).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"outer request", "inner request", "base", "inner response", "outer response"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestChainDefaultTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Chain(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("status code = %d, want %d", resp.StatusCode, http.StatusTeapot)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		next func(req *http.Request) (*http.Response, error)
+		// wantErr is the error from RoundTrip, or nil if the response should be returned
+		wantErr error
+	}{
+		{
+			name: "response",
+			next: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("body")),
+				}, nil
+			},
+		},
+		{
+			name: "error",
+			next: func(*http.Request) (*http.Response, error) {
+				return nil, io.ErrUnexpectedEOF
+			},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "too slow",
+			next: func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ctx context.Context
+			transport := Chain(
+				RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					ctx = req.Context()
+					return test.next(req)
+				}),
+				Timeout(50*time.Millisecond),
+			)
+			req, err := http.NewRequestWithContext(
+				t.Context(),
+				http.MethodGet,
+				"http://example.com",
+				nil,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("RoundTrip() error = %v, want %v", err, test.wantErr)
+				}
+				if ctx.Err() == nil {
+					t.Error("context wasn't canceled after the request failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the body can still be read after the request returns
+			if ctx.Err() != nil {
+				t.Fatalf("context was canceled before the body was closed: %v", ctx.Err())
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil || string(body) != "body" {
+				t.Errorf("body = %q (%v), want %q", body, err, "body")
+			}
+			_ = resp.Body.Close()
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				t.Errorf("context error after the body was closed = %v, want canceled", ctx.Err())
+			}
+		})
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestAuth(t *testing.T) {
+	var sent *http.Request
+	transport := Chain(
+		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return ok(req)
+		}),
+		Auth(func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer token")
+			return nil
+		}),
+	)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sent.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("sent authorization header %q, want %q", got, "Bearer token")
+	}
+	// a round tripper must not change the request it was given
+	if got := req.Header.Get("Authorization"); got != "" {
+		t.Errorf("authorization header %q was set on the original request", got)
+	}
+}
+
+func TestAuthError(t *testing.T) {
+	errNoToken := errors.New("no token")
+	sent := false
+	transport := Chain(
+		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent = true
+			return ok(req)
+		}),
+		Auth(func(*http.Request) error { return errNoToken }),
+	)
+	body := &closeRecorder{Reader: strings.NewReader("body")}
+	req, err := http.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"http://example.com",
+		body,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transport.RoundTrip(req)
+	if !errors.Is(err, errNoToken) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, errNoToken)
+	}
+	if sent {
+		t.Error("sent the request without authorizing it")
+	}
+	if !body.closed {
+		t.Error("didn't close the body of the request")
+	}
+}
+
+func TestLogging(t *testing.T) {
+	tests := []struct {
+		name string
+		// status is the status code of the response, or 0 if err is returned instead
+		status int
+		err    error
+	}{
+		{name: "success", status: http.StatusOK},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "temporary error", err: io.ErrUnexpectedEOF},
+		{name: "error", err: errors.New("bad")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := Chain(
+				RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if test.err != nil {
+						return nil, test.err
+					}
+					return &http.Response{StatusCode: test.status, Body: http.NoBody}, nil
+				}),
+				Logging("test"),
+			)
+			req, err := http.NewRequestWithContext(
+				t.Context(),
+				http.MethodGet,
+				"http://example.com",
+				nil,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if !errors.Is(err, test.err) {
+				t.Errorf("RoundTrip() error = %v, want %v", err, test.err)
+			}
+			if test.err == nil && (resp == nil || resp.StatusCode != test.status) {
+				t.Errorf("RoundTrip() = %+v, want status code %d", resp, test.status)
+			}
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusNotFound, http.StatusOK, 0}
+	attempt := 0
+	metrics := &Metrics{}
+	transport := Chain(
+		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			status := statuses[attempt]
+			attempt++
+			if status == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+		}),
+		Instrument(metrics),
+	)
+	for range statuses {
+		req, err := http.NewRequestWithContext(
+			t.Context(),
+			http.MethodGet,
+			"http://example.com",
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = transport.RoundTrip(req)
+	}
+
+	want := "4 requests (200: 2, 404: 1), 1 failed"
+	if got := metrics.Summary(); !strings.HasPrefix(got, want) {
+		t.Errorf("Summary() = %q, want it to start with %q", got, want)
+	}
+}
+
+func TestInstrumentNil(t *testing.T) {
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Chain(ok, Instrument(nil)).RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() = %+v, %v, want status code %d", resp, err, http.StatusOK)
+	}
+}
@@ -0,0 +1,33 @@
+package apis
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedTransport waits for the limiter before sending each request so that every client
+// sharing the limiter together stays under the rate limit of an API.
+type RateLimitedTransport struct {
+	Limiter *rate.Limiter
+	// Base sends the requests. http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+}
+
+func (t RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := t.Limiter.Wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// NewLimiter creates a limiter that allows requestsPerSecond requests per second on average with
+// bursts of up to a second's worth of requests.
+func NewLimiter(requestsPerSecond float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(requestsPerSecond), max(1, int(requestsPerSecond)))
+}
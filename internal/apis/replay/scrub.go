@@ -0,0 +1,76 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Redacted replaces secrets in fixtures.
+const Redacted = "REDACTED"
+
+var (
+	// secretHeaders aren't recorded at all.
+	secretHeaders = []string{"Authorization", "Music-User-Token", "Cookie", "Set-Cookie"}
+	// secretParams are query parameters whose values are redacted.
+	secretParams = []string{"refresh_token", "client_id", "client_secret", "code"}
+	// secretFields are fields of JSON bodies whose values are redacted.
+	secretFields = []string{"access_token", "refresh_token", "client_secret"}
+)
+
+// scrubURL returns the path and query of u with secret query parameters redacted.
+func scrubURL(u *url.URL) string {
+	query := u.Query()
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+		}
+	}
+	scrubbed := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return scrubbed.RequestURI()
+}
+
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for _, name := range secretHeaders {
+		scrubbed.Del(name)
+	}
+	return scrubbed
+}
+
+// scrubBody redacts secret fields anywhere in a JSON body. Bodies that aren't JSON are returned
+// as is.
+func scrubBody(body []byte) []byte {
+	// numbers are decoded as json.Number so they're written back exactly as they were
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if len(body) == 0 || decoder.Decode(&value) != nil {
+		return body
+	}
+	scrubbed, err := json.Marshal(scrubValue(value))
+	if err != nil {
+		return body
+	}
+	return scrubbed
+}
+
+func scrubValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if slices.Contains(secretFields, key) {
+				value[key] = Redacted
+			} else {
+				value[key] = scrubValue(field)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = scrubValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,222 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// BaseURL replaces the scheme and host that requests were recorded against in response bodies, so
+// links like the next page of a playlist point to wherever the fixture is replayed.
+const BaseURL = "{{base_url}}"
+
+// Recorder sends requests with Base and records them along with their responses, scrubbed of
+// tokens. Call Save to write them to a fixture file.
+type Recorder struct {
+	// Base sends the requests. http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+
+	mutex    sync.Mutex
+	cassette Cassette
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, clone, err := readRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to read request body", err)
+	}
+
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(clone)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to read response body", err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    scrubURL(req.URL),
+			Body:   scrubBody(requestBody),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     scrubHeader(resp.Header),
+			Body:       bytes.ReplaceAll(scrubBody(responseBody), origin(req), []byte(BaseURL)),
+		},
+	})
+	return resp, nil
+}
+
+// Cassette returns everything recorded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return Cassette{Interactions: append([]Interaction{}, r.cassette.Interactions...)}
+}
+
+// Save writes everything recorded so far to a fixture file at path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Replayer responds to requests with the responses from a cassette instead of sending them. Each
+// request gets the response of the first interaction with the same method, URL (ignoring the
+// scheme and host), and body that hasn't been replayed yet, so requests that are sent more than
+// once get their responses in the order they were recorded. Requests without a matching
+// interaction fail.
+type Replayer struct {
+	mutex        sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewReplayer creates a replayer for the interactions in a cassette.
+func NewReplayer(cassette Cassette) *Replayer {
+	return &Replayer{
+		interactions: cassette.Interactions,
+		replayed:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// LoadReplayer creates a replayer for the fixture file at path.
+func LoadReplayer(path string) (*Replayer, error) {
+	cassette, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(cassette), nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, clone, err := readRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to read request body", err)
+	}
+	// the request is never sent so its body has to be closed here
+	if clone.Body != nil {
+		_ = clone.Body.Close()
+	}
+	var (
+		url  = scrubURL(req.URL)
+		body = scrubBody(requestBody)
+	)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, interaction := range r.interactions {
+		recorded := interaction.Request
+		if r.replayed[i] || recorded.Method != req.Method || recorded.URL != url ||
+			!sameBody(recorded.Body, body) {
+			continue
+		}
+		r.replayed[i] = true
+		resp := interaction.Response
+		resp.Body = bytes.ReplaceAll(resp.Body, []byte(BaseURL), origin(req))
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode:    resp.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        resp.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+			ContentLength: int64(len(resp.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, url)
+}
+
+// Unused returns the interactions that haven't been replayed, which usually means that the client
+// sent fewer requests than when the fixture was recorded.
+func (r *Replayer) Unused() []Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	unused := []Interaction{}
+	for i, interaction := range r.interactions {
+		if !r.replayed[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// origin is the scheme and host that the request was sent to.
+func origin(req *http.Request) []byte {
+	return []byte(req.URL.Scheme + "://" + req.URL.Host)
+}
+
+// readRequest reads the body of a request without modifying it, since a RoundTripper must not. The
+// body is read from GetBody when it can be, and otherwise from the body itself. The returned clone
+// of the request is the one to send, with a body that can still be read.
+func readRequest(req *http.Request) ([]byte, *http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, clone, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		binary, err := readBody(&body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return binary, clone, nil
+	}
+
+	body := req.Body
+	binary, err := readBody(&body)
+	if err != nil {
+		return nil, nil, err
+	}
+	clone.Body = body
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(binary)), nil
+	}
+	return binary, clone, nil
+}
+
+// readBody reads a request or response body and replaces it with a copy so it can still be read.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	binary, err := io.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+	err = (*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(binary))
+	return binary, nil
+}
+
+// sameBody compares bodies, ignoring differences in the formatting of JSON bodies.
+func sameBody(a []byte, b []byte) bool {
+	return bytes.Equal(compact(a), compact(b))
+}
+
+func compact(body []byte) []byte {
+	var buf bytes.Buffer
+	if json.Compact(&buf, body) != nil {
+		return body
+	}
+	return buf.Bytes()
+}
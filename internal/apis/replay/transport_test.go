@@ -0,0 +1,213 @@
+package replay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis"
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+const fixturePlaylist = "fixture"
+
+// newFakeSpotify creates a fake with a playlist of five tracks that takes three pages to get.
+func newFakeSpotify(t *testing.T) *fake.Spotify {
+	t.Helper()
+	server := fake.NewSpotify("refresh-token")
+	t.Cleanup(server.Close)
+	server.PageSize = 2
+	for _, name := range []string{"one", "two", "three", "four", "five"} {
+		server.AddTracks(fake.Track{
+			ID:      name,
+			ISRC:    "ISRC" + name,
+			Name:    name,
+			Artists: []string{"band"},
+		})
+	}
+	server.SetPlaylist(fixturePlaylist, "one", "two", "three", "four", "five")
+	return server
+}
+
+func newClient(transport http.RoundTripper, baseURL string) *spotify.Client {
+	return spotify.NewClient(spotify.Options{
+		Transport:    transport,
+		RefreshToken: "refresh-token",
+		BaseURL:      baseURL,
+		AccountsURL:  baseURL,
+	})
+}
+
+// syncFixturePlaylist authorizes, moves the last song of the fixture playlist to the front, and
+// returns the songs in it afterwards.
+func syncFixturePlaylist(t *testing.T, client *spotify.Client) []spotify.Song {
+	t.Helper()
+	err := client.Authorize(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := spotify.PlaylistSongs(t.Context(), client, fixturePlaylist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := songs[len(songs)-1]
+	err = spotify.ReplaceSongs(
+		t.Context(),
+		client,
+		fixturePlaylist,
+		append([]spotify.Song{last}, songs[:len(songs)-1]...),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err = spotify.PlaylistSongs(t.Context(), client, fixturePlaylist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return songs
+}
+
+func songIDs(songs []spotify.Song) []string {
+	ids := []string{}
+	for _, song := range songs {
+		ids = append(ids, song.ID)
+	}
+	return ids
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newFakeSpotify(t)
+	recorder := &Recorder{Base: http.DefaultTransport}
+	recorded := syncFixturePlaylist(t, newClient(recorder, server.URL))
+	want := []string{"five", "one", "two", "three", "four"}
+	if ids := songIDs(recorded); !slices.Equal(ids, want) {
+		t.Fatalf("recorded songs = %v, want %v", ids, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	err := recorder.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := string(binary)
+	for _, secret := range []string{"refresh-token", "access-1", "Authorization", server.URL} {
+		if strings.Contains(fixture, secret) {
+			t.Errorf("fixture contains %q", secret)
+		}
+	}
+	// the links to the next pages of the playlist
+	if !strings.Contains(fixture, BaseURL+"/v1/playlists/"+fixturePlaylist+"/tracks?") {
+		t.Errorf("fixture doesn't link to the next page with %s", BaseURL)
+	}
+
+	replayer, err := LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	replayed := syncFixturePlaylist(t, newClient(replayer, "http://replay.invalid"))
+	if !slices.Equal(replayed, recorded) {
+		t.Errorf("replayed songs = %+v, want %+v", replayed, recorded)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("%d interactions weren't replayed: %+v", len(unused), unused)
+	}
+}
+
+func TestReplayFixture(t *testing.T) {
+	replayer, err := LoadReplayer(filepath.Join("testdata", "spotify_playlist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs := syncFixturePlaylist(t, newClient(replayer, "http://replay.invalid"))
+	want := []string{"five", "one", "two", "three", "four"}
+	if ids := songIDs(songs); !slices.Equal(ids, want) {
+		t.Errorf("songs = %v, want %v", ids, want)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("%d interactions weren't replayed: %+v", len(unused), unused)
+	}
+}
+
+func TestRoundTripLeavesRequestAlone(t *testing.T) {
+	const body = `{"uris": ["spotify:track:one"]}`
+	cassette := Cassette{Interactions: []Interaction{{
+		Request:  Request{Method: http.MethodPost, URL: "/tracks", Body: Body(body)},
+		Response: Response{StatusCode: http.StatusCreated},
+	}}}
+	transports := []struct {
+		name      string
+		transport func() http.RoundTripper
+	}{
+		{
+			name: "recorder",
+			transport: func() http.RoundTripper {
+				return &Recorder{Base: apis.RoundTripperFunc(
+					func(req *http.Request) (*http.Response, error) {
+						sent, err := io.ReadAll(req.Body)
+						if err != nil || string(sent) != body {
+							t.Errorf("sent body %q (%v), want %q", sent, err, body)
+						}
+						return &http.Response{StatusCode: http.StatusCreated, Body: http.NoBody}, nil
+					},
+				)}
+			},
+		},
+		{
+			name:      "replayer",
+			transport: func() http.RoundTripper { return NewReplayer(cassette) },
+		},
+	}
+	requests := []struct {
+		name    string
+		getBody bool
+	}{
+		{name: "with GetBody", getBody: true},
+		{name: "without GetBody", getBody: false},
+	}
+	for _, transport := range transports {
+		for _, request := range requests {
+			t.Run(transport.name+" "+request.name, func(t *testing.T) {
+				req, err := http.NewRequestWithContext(
+					t.Context(),
+					http.MethodPost,
+					"http://example.com/tracks",
+					bytes.NewReader([]byte(body)),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !request.getBody {
+					req.Body = io.NopCloser(strings.NewReader(body))
+					req.GetBody = nil
+				}
+				original := req.Body
+
+				resp, err := transport.transport().RoundTrip(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusCreated {
+					t.Errorf("status code = %d, want %d", resp.StatusCode, http.StatusCreated)
+				}
+				if req.Body != original {
+					t.Error("request body was replaced")
+				}
+				if request.getBody != (req.GetBody != nil) {
+					t.Error("GetBody of the request was changed")
+				}
+			})
+		}
+	}
+}
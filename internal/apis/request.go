@@ -1,15 +1,11 @@
 package apis
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
-	"strings"
-	"time"
 
 	"go.mattglei.ch/timber"
 )
@@ -17,71 +13,48 @@ import (
 // ErrWarning indicates that a non-critical error occurred during a request. Although the error
 // prevents the cache from being updated, it is expected under certain transient conditions (for
 // example, a 502 Gateway error) that are beyond our control. Such errors warrant only a warning
-// rather than a full failure.
+// rather than a full failure. Retryable StatusErrors match it with errors.Is.
 var ErrWarning = errors.New("non-critical error encountered during request")
 
-// Request sends an HTTP request using the provided client with a 1-minute timeout and returns
-// the response body as a byte slice. It handles common transient network errors—including timeouts,
-// unexpected EOFs, and TCP connection resets—by logging warnings and returning a non-critical
-// WarningError. Non-2xx HTTP responses are also treated as warnings.
-func Request(logPrefix string, client *http.Client, req *http.Request) ([]byte, error) {
-	var body []byte
-	retries := 0
-	for {
-		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Minute)
-		defer cancel()
-		req = req.WithContext(ctx)
-
-		resp, err := client.Do(req)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				timber.Warning(logPrefix, "connection timed out for", req.URL.Path)
-				return []byte{}, ErrWarning
-			}
-			if errors.Is(err, context.DeadlineExceeded) {
-				timber.Warning(logPrefix, "request timed out for", req.URL.Path)
-				return []byte{}, ErrWarning
-			}
-			if errors.Is(err, io.ErrUnexpectedEOF) {
-				timber.Warning(logPrefix, "unexpected EOF from", req.URL.Path)
-				return []byte{}, ErrWarning
-			}
-			if strings.Contains(err.Error(), "read: connection reset by peer") {
-				timber.Warning(logPrefix, "tcp connection reset by peer from", req.URL.Path)
-				return []byte{}, ErrWarning
-			}
-			return []byte{}, fmt.Errorf("%w sending request to %s failed", err, req.URL.String())
-		}
-
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			timber.Warning(
-				logPrefix,
-				resp.StatusCode,
-				fmt.Sprintf("(%s)", strings.ToLower(http.StatusText(resp.StatusCode))),
-				"to",
+// Request sends an HTTP request using the provided client and returns the response body as a byte
+// slice. Timeouts, retries, rate limiting, and logging are left to the middleware of the client's
+// transport (see Chain). Non-2xx responses are returned as a *StatusError, and transient network
+// errors (timeouts, unexpected EOFs, and TCP connection resets) wrap the non-critical ErrWarning.
+// provider is the name of the API, which is set on errors.
+func Request(provider string, client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if description, ok := temporary(err); ok && req.Context().Err() == nil {
+			return []byte{}, fmt.Errorf(
+				"%w %s %s: %s",
+				ErrWarning,
+				description,
 				req.URL.String(),
+				err.Error(),
 			)
-			if retries < 3 {
-				timber.Warning("retrying request in 30 seconds...")
-				time.Sleep(30 * time.Second)
-				retries++
-				continue
-			}
-			return []byte{}, ErrWarning
-		}
-
-		body, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return []byte{}, fmt.Errorf("%w reading response body failed", err)
 		}
+		return []byte{}, fmt.Errorf("%w sending request to %s failed", err, req.URL.String())
+	}
+	defer resp.Body.Close()
 
-		err = resp.Body.Close()
-		if err != nil {
-			return []byte{}, fmt.Errorf("%w failed to close response body", err)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// the body is only read to explain the error so a broken one isn't worth failing over
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return []byte{}, &StatusError{
+			Provider:   provider,
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Message:    errorMessage(body),
+			Body:       body,
+			Retryable:  retryableStatus(resp.StatusCode),
 		}
-		break
 	}
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return []byte{}, fmt.Errorf("%w reading response body failed", err)
+	}
 	return body, nil
 }
 
@@ -98,14 +71,14 @@ func Request(logPrefix string, client *http.Client, req *http.Request) ([]byte,
 //
 // On any error path, the zero value of T is returned alongside the error.
 func RequestJSON[T any](
-	logPrefix string,
+	provider string,
 	client *http.Client,
 	req *http.Request,
 	noJsonResponse bool,
 ) (T, error) {
 	var data T
 
-	body, err := Request(logPrefix, client, req)
+	body, err := Request(provider, client, req)
 	if err != nil {
 		return data, err
 	}
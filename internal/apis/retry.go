@@ -0,0 +1,121 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy is how failed requests are retried. Rate limited requests wait for as long as the
+// Retry-After header of the response asks, server errors and network errors back off
+// exponentially with jitter, and every other error fails right away.
+type RetryPolicy struct {
+	// MaxRetries is how many times a request is retried before giving up.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, which doubles for each retry after it.
+	BaseDelay time.Duration
+	// MaxDelay is the longest delay between retries. Requests whose Retry-After is longer than it
+	// aren't retried.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by the API clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 4,
+	BaseDelay:  2 * time.Second,
+	MaxDelay:   2 * time.Minute,
+}
+
+// backoff is the delay before the retry after the given number of retries. It is a random
+// duration between half and all of the exponential delay so that retries from different requests
+// are spread out.
+func (p RetryPolicy) backoff(retries int) time.Duration {
+	delay := min(p.BaseDelay<<retries, p.MaxDelay)
+	if delay <= 0 {
+		delay = p.MaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// statusDelay is how long to wait before retrying a response with the given status code, or false
+// if it shouldn't be retried.
+func (p RetryPolicy) statusDelay(
+	resp *http.Response,
+	retries int,
+	now time.Time,
+) (time.Duration, bool) {
+	if !retryableStatus(resp.StatusCode) {
+		return 0, false
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok {
+			return delay, delay <= p.MaxDelay
+		}
+	}
+	return p.backoff(retries), true
+}
+
+// retryableStatus reports if a response with the status code could succeed if the request is sent
+// again.
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode >= 500
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// idempotent reports if sending a request with the method more than once has the same effect as
+// sending it once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut,
+		http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// notSent reports if a request failed because a connection to the server couldn't be made, so
+// the server never got the request.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// temporary reports if a request failed because of a network error that might not happen again,
+// along with a description of the error for logging.
+func temporary(err error) (string, bool) {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "connection timed out for", true
+	case errors.Is(err, context.DeadlineExceeded):
+		return "request timed out for", true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "unexpected EOF from", true
+	case strings.Contains(err.Error(), "read: connection reset by peer"):
+		return "tcp connection reset by peer from", true
+	default:
+		return "", false
+	}
+}
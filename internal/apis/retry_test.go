@@ -0,0 +1,349 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+	tests := []struct {
+		retries int
+		max     time.Duration
+	}{
+		{retries: 0, max: time.Second},
+		{retries: 1, max: 2 * time.Second},
+		{retries: 3, max: 8 * time.Second},
+		{retries: 6, max: time.Minute},
+		// the exponential delay overflows
+		{retries: 70, max: time.Minute},
+	}
+	for _, test := range tests {
+		for range 100 {
+			delay := policy.backoff(test.retries)
+			if delay < test.max/2 || delay > test.max {
+				t.Fatalf(
+					"backoff(%d) = %s, want between %s and %s",
+					test.retries,
+					delay,
+					test.max/2,
+					test.max,
+				)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{header: "", wantOK: false},
+		{header: "30", want: 30 * time.Second, wantOK: true},
+		{header: "-5", want: 0, wantOK: true},
+		{header: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOK: true},
+		{header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{header: "soon", wantOK: false},
+	}
+	for _, test := range tests {
+		delay, ok := retryAfter(test.header, now)
+		if delay != test.want || ok != test.wantOK {
+			t.Errorf(
+				"retryAfter(%q) = %s, %t, want %s, %t",
+				test.header,
+				delay,
+				ok,
+				test.want,
+				test.wantOK,
+			)
+		}
+	}
+}
+
+func TestStatusDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+	tests := []struct {
+		name       string
+		statusCode int
+		retryAfter string
+		min        time.Duration
+		max        time.Duration
+		wantOK     bool
+	}{
+		{name: "ok", statusCode: http.StatusOK},
+		{name: "not found", statusCode: http.StatusNotFound},
+		{name: "bad request", statusCode: http.StatusBadRequest},
+		{
+			name:       "server error",
+			statusCode: http.StatusBadGateway,
+			min:        time.Second,
+			max:        2 * time.Second,
+			wantOK:     true,
+		},
+		{
+			name:       "request timeout",
+			statusCode: http.StatusRequestTimeout,
+			min:        time.Second,
+			max:        2 * time.Second,
+			wantOK:     true,
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "10",
+			min:        10 * time.Second,
+			max:        10 * time.Second,
+			wantOK:     true,
+		},
+		{
+			name:       "rate limited without retry after",
+			statusCode: http.StatusTooManyRequests,
+			min:        time.Second,
+			max:        2 * time.Second,
+			wantOK:     true,
+		},
+		{
+			name:       "rate limited for too long",
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "3600",
+			min:        time.Hour,
+			max:        time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: test.statusCode, Header: http.Header{}}
+			if test.retryAfter != "" {
+				resp.Header.Set("Retry-After", test.retryAfter)
+			}
+			delay, ok := policy.statusDelay(resp, 1, time.Now())
+			if ok != test.wantOK {
+				t.Fatalf("statusDelay() ok = %t, want %t", ok, test.wantOK)
+			}
+			if delay < test.min || delay > test.max {
+				t.Errorf("statusDelay() = %s, want between %s and %s", delay, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	tests := []struct {
+		name   string
+		method string
+		// statuses are the status codes of each attempt. The last one is repeated.
+		statuses []int
+		// body is sent with the request, and getBody is if it can be read again
+		body    string
+		getBody bool
+		want    int
+		// wantAttempts is how many times the request should be sent
+		wantAttempts int
+	}{
+		{
+			name:         "success",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusOK},
+			want:         http.StatusOK,
+			wantAttempts: 1,
+		},
+		{
+			name:         "server error then success",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			want:         http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "max retries",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusServiceUnavailable},
+			want:         http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "not retryable",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusNotFound},
+			want:         http.StatusNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:         "idempotent with a body",
+			method:       http.MethodPut,
+			statuses:     []int{http.StatusBadGateway, http.StatusOK},
+			body:         `{"range_start": 1}`,
+			getBody:      true,
+			want:         http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "post server error",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusBadGateway, http.StatusCreated},
+			body:         `{"uris": []}`,
+			getBody:      true,
+			want:         http.StatusBadGateway,
+			wantAttempts: 1,
+		},
+		{
+			name:         "post rate limited",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusCreated},
+			body:         `{"uris": []}`,
+			getBody:      true,
+			want:         http.StatusCreated,
+			wantAttempts: 2,
+		},
+		{
+			name:         "body that can't be read again",
+			method:       http.MethodPut,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			body:         `{"range_start": 1}`,
+			getBody:      false,
+			want:         http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := int(attempts.Add(1))
+				body, err := io.ReadAll(r.Body)
+				if err != nil || string(body) != test.body {
+					t.Errorf("attempt %d sent body %q (%v), want %q", attempt, body, err, test.body)
+				}
+				status := test.statuses[min(attempt, len(test.statuses))-1]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+			}))
+			t.Cleanup(server.Close)
+
+			req, err := http.NewRequestWithContext(
+				t.Context(),
+				test.method,
+				server.URL,
+				strings.NewReader(test.body),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.body == "" {
+				req.Body, req.GetBody = http.NoBody, nil
+			} else if !test.getBody {
+				req.Body, req.GetBody = io.NopCloser(strings.NewReader(test.body)), nil
+			}
+
+			resp, err := Chain(nil, Retry(policy, "test")).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != test.want {
+				t.Errorf("status code = %d, want %d", resp.StatusCode, test.want)
+			}
+			if got := int(attempts.Load()); got != test.wantAttempts {
+				t.Errorf("sent %d attempts, want %d", got, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	// nothing is listening once the server is closed so connecting to it fails
+	closedURL := server.URL
+	server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		// wantAttempts is how many times the request should be sent
+		wantAttempts int
+	}{
+		{name: "get unexpected eof", method: http.MethodGet, err: io.ErrUnexpectedEOF, wantAttempts: 3},
+		{name: "post unexpected eof", method: http.MethodPost, err: io.ErrUnexpectedEOF, wantAttempts: 1},
+		{name: "post not sent", method: http.MethodPost, wantAttempts: 3},
+		{name: "permanent", method: http.MethodGet, err: errors.New("bad"), wantAttempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			transport := Chain(
+				RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if test.err != nil {
+						return nil, test.err
+					}
+					return http.DefaultTransport.RoundTrip(req)
+				}),
+				Retry(policy, "test"),
+			)
+			req, err := http.NewRequestWithContext(t.Context(), test.method, closedURL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = transport.RoundTrip(req)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("sent %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = Chain(nil, Retry(policy, "test")).RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to stop retrying", elapsed)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	for method, want := range map[string]bool{
+		http.MethodGet:     true,
+		http.MethodPut:     true,
+		http.MethodDelete:  true,
+		http.MethodPost:    false,
+		http.MethodPatch:   false,
+		http.MethodConnect: false,
+	} {
+		if got := idempotent(method); got != want {
+			t.Errorf("idempotent(%s) = %t, want %t", method, got, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,12 +10,138 @@ import (
 	"time"
 
 	"go.mattglei.ch/musicsync/internal/apis"
+	"golang.org/x/time/rate"
 )
 
+const (
+	// DefaultBaseURL is where Spotify Web API requests are sent unless a client has its own
+	// BaseURL.
+	DefaultBaseURL = "https://api.spotify.com"
+	// DefaultAccountsURL is where access tokens are refreshed unless a client has its own
+	// AccountsURL.
+	DefaultAccountsURL = "https://accounts.spotify.com"
+)
+
+// Client is safe to share between goroutines. The access token is refreshed by one goroutine at a
+// time when it expires. Create clients with NewClient.
 type Client struct {
-	HttpClient *http.Client
-	Tokens     *Tokens
-	mutex      sync.RWMutex
+	Tokens *Tokens
+	// BaseURL and AccountsURL are the scheme and host that API requests and token refreshes are
+	// sent to. DefaultBaseURL and DefaultAccountsURL are used if they are empty.
+	BaseURL      string
+	AccountsURL  string
+	api          *http.Client
+	accounts     *http.Client
+	mutex        sync.RWMutex
+	refreshMutex sync.Mutex
+}
+
+// Options configures a client created with NewClient.
+type Options struct {
+	// Transport sends the requests once they've gone through the middleware.
+	// http.DefaultTransport is used if it is nil.
+	Transport    http.RoundTripper
+	RefreshToken string
+	BaseURL      string
+	AccountsURL  string
+	// Limiter is shared by every request the client sends, including token refreshes. Requests
+	// aren't rate limited if it is nil.
+	Limiter *rate.Limiter
+	// Metrics records every request the client sends if it isn't nil.
+	Metrics *apis.Metrics
+	// Timeout is how long each attempt at a request can take. apis.DefaultTimeout is used if it
+	// is zero.
+	Timeout time.Duration
+}
+
+// NewClient creates a client whose requests are retried, authorized, rate limited, timed out,
+// logged, and recorded, in that order.
+func NewClient(opts Options) *Client {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = apis.DefaultTimeout
+	}
+	c := &Client{
+		Tokens:      &Tokens{RefreshToken: opts.RefreshToken},
+		BaseURL:     opts.BaseURL,
+		AccountsURL: opts.AccountsURL,
+	}
+	c.api = &http.Client{Transport: apis.Chain(
+		opts.Transport,
+		apis.Retry(apis.DefaultRetryPolicy, "spotify"),
+		c.authorize,
+		apis.RateLimit(opts.Limiter),
+		apis.Timeout(timeout),
+		apis.Logging("spotify"),
+		apis.Instrument(opts.Metrics),
+	)}
+	// token refreshes set their own authorization header
+	c.accounts = &http.Client{Transport: apis.Chain(
+		opts.Transport,
+		apis.Retry(apis.DefaultRetryPolicy, "spotify"),
+		apis.RateLimit(opts.Limiter),
+		apis.Timeout(timeout),
+		apis.Logging("spotify"),
+		apis.Instrument(opts.Metrics),
+	)}
+	return c
+}
+
+// authorize sets the access token on each request. If the token is rejected because it was
+// revoked before it expired, the token is refreshed and the request is sent once more.
+func (c *Client) authorize(next http.RoundTripper) http.RoundTripper {
+	return apis.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		accessToken, err := c.accessToken(ctx)
+		if err != nil {
+			closeBody(req)
+			return nil, fmt.Errorf("%w failed to refresh access token", err)
+		}
+		authorized := req.Clone(ctx)
+		authorized.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := next.RoundTrip(authorized)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized ||
+			(req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		// the body is drained so the connection can be reused for the resent request
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+		accessToken, err = c.refreshAccessToken(ctx, accessToken)
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to refresh rejected access token", err)
+		}
+		authorized = req.Clone(ctx)
+		if req.GetBody != nil {
+			authorized.Body, err = req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("%w failed to reset request body", err)
+			}
+		}
+		authorized.Header.Set("Authorization", "Bearer "+accessToken)
+		return next.RoundTrip(authorized)
+	})
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+func (c *Client) accountsURL() string {
+	if c.AccountsURL == "" {
+		return DefaultAccountsURL
+	}
+	return strings.TrimRight(c.AccountsURL, "/")
 }
 
 type spotifyRequest struct {
@@ -25,32 +152,24 @@ type spotifyRequest struct {
 }
 
 func sendSpotifyAPIRequest[T any](
+	ctx context.Context,
 	client *Client,
 	request spotifyRequest,
 ) (T, error) {
 	var zeroValue T
-
-	if client.Tokens.ExpiresAt.Before(time.Now()) {
-		err := client.Authorize()
-		if err != nil {
-			return zeroValue, fmt.Errorf("%w failed to refresh access token", err)
-		}
-	}
-
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		request.Method,
-		fmt.Sprintf("https://api.spotify.com/%s", strings.TrimLeft(request.Path, "/")),
+		fmt.Sprintf("%s/%s", client.baseURL(), strings.TrimLeft(request.Path, "/")),
 		request.Body,
 	)
 	if err != nil {
 		return zeroValue, fmt.Errorf("%w failed to create request", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.Tokens.AccessToken))
-
-	resp, err := apis.RequestJSON[T]("[spotify]", client.HttpClient, req, request.NotExpectingJSON)
+	resp, err := apis.RequestJSON[T]("spotify", client.api, req, request.NotExpectingJSON)
 	if err != nil {
-		return zeroValue, fmt.Errorf("%w failed to make apple music API request", err)
+		return zeroValue, fmt.Errorf("%w failed to make spotify API request", err)
 	}
 	return resp, nil
 }
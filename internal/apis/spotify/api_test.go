@@ -0,0 +1,139 @@
+package spotify
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis"
+	"golang.org/x/time/rate"
+)
+
+// TestClientMiddleware checks that the access token is set on every attempt at a request and
+// refreshed inside the retries, and that every attempt and refresh waits for the rate limiter.
+func TestClientMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses are the status codes of each attempt at the request
+		statuses []int
+		// want is the status code of the last attempt, or 0 if the request succeeded
+		want int
+		// wantTokens are the access tokens each attempt is sent with
+		wantTokens    []string
+		wantRefreshes int
+	}{
+		{
+			name:       "success",
+			statuses:   []int{http.StatusOK},
+			wantTokens: []string{"access"},
+		},
+		{
+			name:       "rate limited",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantTokens: []string{"access", "access"},
+		},
+		{
+			name:          "token rejected",
+			statuses:      []int{http.StatusUnauthorized, http.StatusOK},
+			wantTokens:    []string{"access", "fresh"},
+			wantRefreshes: 1,
+		},
+		{
+			name: "token rejected after a retry",
+			statuses: []int{
+				http.StatusTooManyRequests,
+				http.StatusUnauthorized,
+				http.StatusOK,
+			},
+			wantTokens:    []string{"access", "access", "fresh"},
+			wantRefreshes: 1,
+		},
+		{
+			// a rejected token is only refreshed once and the rejection isn't retried
+			name:          "fresh token rejected",
+			statuses:      []int{http.StatusUnauthorized, http.StatusUnauthorized},
+			want:          http.StatusUnauthorized,
+			wantTokens:    []string{"access", "fresh"},
+			wantRefreshes: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				mutex     sync.Mutex
+				tokens    = []string{}
+				refreshes = 0
+			)
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, _ *http.Request) {
+				mutex.Lock()
+				refreshes++
+				mutex.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"access_token": "fresh", "expires_in": 3600}`))
+			})
+			mux.HandleFunc("GET /v1/me", func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				tokens = append(tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+				status := test.statuses[len(tokens)-1]
+				mutex.Unlock()
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{}`))
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			// the limiter doesn't refill during the test so the tokens it has left show how many
+			// requests waited for it
+			const burst = 10
+			var (
+				limiter = rate.NewLimiter(rate.Every(time.Hour), burst)
+				metrics = &apis.Metrics{}
+				client  = NewClient(Options{
+					BaseURL:     server.URL,
+					AccountsURL: server.URL,
+					Limiter:     limiter,
+					Metrics:     metrics,
+				})
+			)
+			client.Tokens = &Tokens{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}
+
+			_, err := sendSpotifyAPIRequest[struct{}](
+				t.Context(),
+				client,
+				spotifyRequest{Method: http.MethodGet, Path: "/v1/me"},
+			)
+			switch {
+			case test.want == 0 && err != nil:
+				t.Fatal(err)
+			case test.want != 0 && !apis.HasStatus(err, test.want):
+				t.Fatalf("error = %v, want status code %d", err, test.want)
+			}
+
+			if !slices.Equal(tokens, test.wantTokens) {
+				t.Errorf("sent access tokens %v, want %v", tokens, test.wantTokens)
+			}
+			if refreshes != test.wantRefreshes {
+				t.Errorf("refreshed %d times, want %d", refreshes, test.wantRefreshes)
+			}
+			requests := len(test.wantTokens) + test.wantRefreshes
+			if waited := int(math.Round(burst - limiter.Tokens())); waited != requests {
+				t.Errorf("%d requests waited for the limiter, want %d", waited, requests)
+			}
+			want := strconv.Itoa(requests) + " requests"
+			if got := metrics.Summary(); !strings.HasPrefix(got, want) {
+				t.Errorf("Summary() = %q, want it to start with %q", got, want)
+			}
+		})
+	}
+}
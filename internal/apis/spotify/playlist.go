@@ -2,12 +2,16 @@ package spotify
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"go.mattglei.ch/musicsync/internal/apis"
 	"go.mattglei.ch/musicsync/internal/utils"
 )
 
@@ -31,24 +35,44 @@ type removeSongsPayload struct {
 	SnapshotID string  `json:"snapshot_id"`
 }
 
+type reorderSongsPayload struct {
+	RangeStart   int    `json:"range_start"`
+	InsertBefore int    `json:"insert_before"`
+	RangeLength  int    `json:"range_length"`
+	SnapshotID   string `json:"snapshot_id"`
+}
+
 type track struct {
-	URI string `json:"uri"`
+	URI       string `json:"uri"`
+	Positions []int  `json:"positions"`
 }
 
-func PlaylistSnapshot(client *Client, id string) (string, error) {
+// ErrPlaylistNotFound is returned when Spotify doesn't have a playlist with the given ID.
+var ErrPlaylistNotFound = errors.New("spotify playlist not found")
+
+func PlaylistSnapshot(ctx context.Context, client *Client, id string) (string, error) {
 	req := spotifyRequest{Method: http.MethodGet, Path: fmt.Sprintf("/v1/playlists/%s", id)}
-	resp, err := sendSpotifyAPIRequest[PlaylistResponse](client, req)
+	resp, err := sendSpotifyAPIRequest[PlaylistResponse](ctx, client, req)
+	if apis.HasStatus(err, http.StatusNotFound) {
+		return "", fmt.Errorf("%w with id of %s", ErrPlaylistNotFound, id)
+	}
 	if err != nil {
 		return "", fmt.Errorf("%w failed to make request for playlist data", err)
 	}
 	return resp.SnapshotID, nil
 }
 
-func PlaylistSongs(client *Client, id string) ([]Song, error) {
+// PlaylistSongs returns the songs in the playlist. Local files and tracks that are no longer
+// available (which have no track ID) are left out, but Position is still the position of each
+// song in the whole playlist so songs are removed from the right position.
+func PlaylistSongs(ctx context.Context, client *Client, id string) ([]Song, error) {
 	req := spotifyRequest{Method: http.MethodGet, Path: fmt.Sprintf("/v1/playlists/%s/tracks", id)}
-	songs := []Song{}
+	var (
+		songs    = []Song{}
+		position = 0
+	)
 	for {
-		resp, err := sendSpotifyAPIRequest[PlaylistTracksResponse](client, req)
+		resp, err := sendSpotifyAPIRequest[PlaylistTracksResponse](ctx, client, req)
 		if err != nil {
 			return []Song{}, fmt.Errorf(
 				"%w failed to get spotify playlist data for: %s",
@@ -56,26 +80,37 @@ func PlaylistSongs(client *Client, id string) ([]Song, error) {
 				id,
 			)
 		}
-		for _, track := range resp.Items {
-			songs = append(songs, Song{
-				ID:     track.Track.ID,
-				ISRC:   track.Track.ExternalIDs.ISRC,
-				Name:   track.Track.Name,
-				Artist: track.Track.Artists[0].Name,
-			})
+		for _, item := range resp.Items {
+			song := item.Track.song()
+			song.Position = position
+			position++
+			if song.ID != "" {
+				songs = append(songs, song)
+			}
 		}
 
 		if resp.Next == "" {
 			break
 		}
 
-		req.Path = strings.TrimPrefix(resp.Next, "https://api.spotify.com")
+		req.Path = strings.TrimPrefix(resp.Next, client.baseURL())
 	}
 
 	return songs, nil
 }
 
-func EditSongs(client *Client, id string, songs []Song, snapshotID *string) error {
+// EditSongs adds songs to the end of the playlist if snapshotID is nil. Otherwise the songs are
+// removed from the playlist at their positions in the version of the playlist from snapshotID,
+// which leaves any other copies of the songs in place. Each batch of removals is sent against the
+// version of the playlist from the batch before it, with the positions moved up by the songs that
+// were already removed before them. The snapshot ID of the playlist after the edit is returned.
+func EditSongs(
+	ctx context.Context,
+	client *Client,
+	id string,
+	songs []Song,
+	snapshotID *string,
+) (string, error) {
 	batches := utils.Batch(songs, 100)
 	var method string
 	if snapshotID == nil {
@@ -84,28 +119,91 @@ func EditSongs(client *Client, id string, songs []Song, snapshotID *string) erro
 		method = http.MethodDelete
 	}
 
+	var (
+		edited  string
+		removed []int
+	)
+	if snapshotID != nil {
+		edited = *snapshotID
+	}
 	for _, batch := range batches {
-		tracks := []string{}
-		for _, song := range batch {
-			tracks = append(tracks, fmt.Sprintf("spotify:track:%s", song.ID))
-		}
-
 		var payload any
 		if snapshotID == nil {
-			payload = addSongsPayload{URIs: tracks}
+			uris := []string{}
+			for _, song := range batch {
+				uris = append(uris, fmt.Sprintf("spotify:track:%s", song.ID))
+			}
+			payload = addSongsPayload{URIs: uris}
 		} else {
 			removeTracks := []track{}
-			for _, t := range tracks {
-				removeTracks = append(removeTracks, track{URI: t})
+			indexes := map[string]int{}
+			for _, song := range batch {
+				uri := fmt.Sprintf("spotify:track:%s", song.ID)
+				before, _ := slices.BinarySearch(removed, song.Position)
+				position := song.Position - before
+				if i, ok := indexes[uri]; ok {
+					removeTracks[i].Positions = append(removeTracks[i].Positions, position)
+					continue
+				}
+				indexes[uri] = len(removeTracks)
+				removeTracks = append(removeTracks, track{URI: uri, Positions: []int{position}})
 			}
-			payload = removeSongsPayload{Tracks: removeTracks, SnapshotID: *snapshotID}
+			payload = removeSongsPayload{Tracks: removeTracks, SnapshotID: edited}
 		}
 		binary, err := json.Marshal(payload)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to json marshal payload", err)
+		}
+
+		resp, err := sendSpotifyAPIRequest[PlaylistResponse](
+			ctx,
+			client,
+			spotifyRequest{
+				Method: method,
+				Path:   fmt.Sprintf("/v1/playlists/%s/tracks", id),
+				Body:   bytes.NewReader(binary),
+			},
+		)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to send spotify api request", err)
+		}
+		edited = resp.SnapshotID
+		if snapshotID != nil {
+			for _, song := range batch {
+				i, _ := slices.BinarySearch(removed, song.Position)
+				removed = slices.Insert(removed, i, song.Position)
+			}
+		}
+	}
+
+	return edited, nil
+}
+
+// ReplaceSongs replaces every song in the playlist with songs, in order. The playlist is cleared
+// if songs is empty.
+func ReplaceSongs(ctx context.Context, client *Client, id string, songs []Song) error {
+	batches := utils.Batch(songs, 100)
+	if len(batches) == 0 {
+		// the first request is always sent so that an empty playlist is still cleared
+		batches = [][]Song{{}}
+	}
+	for i, batch := range batches {
+		uris := []string{}
+		for _, song := range batch {
+			uris = append(uris, fmt.Sprintf("spotify:track:%s", song.ID))
+		}
+		binary, err := json.Marshal(addSongsPayload{URIs: uris})
 		if err != nil {
 			return fmt.Errorf("%w failed to json marshal payload", err)
 		}
 
+		// only the first batch replaces the songs and the rest are added after it
+		method := http.MethodPut
+		if i != 0 {
+			method = http.MethodPost
+		}
 		_, err = sendSpotifyAPIRequest[any](
+			ctx,
 			client,
 			spotifyRequest{
 				Method: method,
@@ -117,22 +215,59 @@ func EditSongs(client *Client, id string, songs []Song, snapshotID *string) erro
 			return fmt.Errorf("%w failed to send spotify api request", err)
 		}
 	}
-
 	return nil
 }
 
-func UpdateDescription(
+// MoveSongs moves the rangeLength songs starting at rangeStart to be before the song at
+// insertBefore. The playlist must still be at the version of snapshotID, which is updated to the
+// new version of the playlist.
+func MoveSongs(
+	ctx context.Context,
 	client *Client,
-	spotifyID string,
-	appleMusicID string,
-	location *time.Location,
+	id string,
+	rangeStart int,
+	rangeLength int,
+	insertBefore int,
+	snapshotID *string,
 ) error {
-	description := fmt.Sprintf(
+	binary, err := json.Marshal(reorderSongsPayload{
+		RangeStart:   rangeStart,
+		InsertBefore: insertBefore,
+		RangeLength:  rangeLength,
+		SnapshotID:   *snapshotID,
+	})
+	if err != nil {
+		return fmt.Errorf("%w failed to json marshal payload", err)
+	}
+
+	resp, err := sendSpotifyAPIRequest[PlaylistResponse](ctx, client, spotifyRequest{
+		Method: http.MethodPut,
+		Path:   fmt.Sprintf("/v1/playlists/%s/tracks", id),
+		Body:   bytes.NewReader(binary),
+	})
+	if err != nil {
+		return fmt.Errorf("%w failed to send spotify api request", err)
+	}
+	*snapshotID = resp.SnapshotID
+	return nil
+}
+
+// Description is the playlist description that links back to the Apple Music playlist and notes
+// when it was last updated.
+func Description(appleMusicID string, location *time.Location) string {
+	return fmt.Sprintf(
 		"https://mattglei.ch/music/playlists/%s. Auto updated %s.",
 		appleMusicID,
 		time.Now().In(location).Format("Jan 2 2006 at 3:04pm MST"),
 	)
+}
 
+func UpdateDescription(
+	ctx context.Context,
+	client *Client,
+	spotifyID string,
+	description string,
+) error {
 	binary, err := json.Marshal(struct {
 		Description string `json:"description"`
 	}{Description: description})
@@ -140,7 +275,7 @@ func UpdateDescription(
 		return fmt.Errorf("%w failed to marshal JSON", err)
 	}
 
-	_, err = sendSpotifyAPIRequest[any](client, spotifyRequest{
+	_, err = sendSpotifyAPIRequest[any](ctx, client, spotifyRequest{
 		Method:           http.MethodPut,
 		Path:             fmt.Sprintf("/v1/playlists/%s", spotifyID),
 		Body:             bytes.NewReader(binary),
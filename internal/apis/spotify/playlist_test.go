@@ -0,0 +1,132 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlaylistSongsSkipsLocalAndUnavailableTracks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items": [
+			{"track": {"id": "one", "name": "One", "artists": [{"name": "Artist"}],
+				"external_ids": {"isrc": "ISRC1"}}},
+			{"track": null},
+			{"track": {"id": null, "name": "Local", "artists": []}},
+			{"track": {"id": "two", "name": "Two", "artists": [{"name": "Artist"}]}}
+		]}`))
+	}))
+	defer server.Close()
+	client := NewClient(Options{BaseURL: server.URL})
+	client.Tokens = &Tokens{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}
+
+	songs, err := PlaylistSongs(t.Context(), client, "playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Song{
+		{ID: "one", ISRC: "ISRC1", Name: "One", Artist: "Artist", Position: 0},
+		{ID: "two", Name: "Two", Artist: "Artist", Position: 3},
+	}
+	if !slices.Equal(songs, want) {
+		t.Errorf("songs = %+v, want %+v", songs, want)
+	}
+}
+
+func TestEditSongsReturnsLastSnapshot(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"snapshot_id": "snapshot-%d"}`, requests)
+	}))
+	defer server.Close()
+	client := NewClient(Options{BaseURL: server.URL})
+	client.Tokens = &Tokens{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}
+
+	// more songs than fit in one request
+	songs := make([]Song, 150)
+	for i := range songs {
+		songs[i] = Song{ID: fmt.Sprint(i)}
+	}
+	snapshotID, err := EditSongs(t.Context(), client, "playlist", songs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("sent %d requests, want 2", requests)
+	}
+	if snapshotID != "snapshot-2" {
+		t.Errorf("got snapshot id %q, want %q", snapshotID, "snapshot-2")
+	}
+}
+
+func TestReplaceSongs(t *testing.T) {
+	type request struct {
+		method string
+		uris   int
+	}
+	tests := []struct {
+		name  string
+		songs int
+		want  []request
+	}{
+		{name: "empty", songs: 0, want: []request{{http.MethodPut, 0}}},
+		{name: "one batch", songs: 100, want: []request{{http.MethodPut, 100}}},
+		{
+			name:  "many batches",
+			songs: 250,
+			want: []request{
+				{http.MethodPut, 100},
+				{http.MethodPost, 100},
+				{http.MethodPost, 50},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				requests = []request{}
+				uris     = []string{}
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					URIs []string `json:"uris"`
+				}
+				err := json.NewDecoder(r.Body).Decode(&body)
+				if err != nil || body.URIs == nil {
+					t.Errorf("%s request without uris: %v", r.Method, err)
+				}
+				requests = append(requests, request{r.Method, len(body.URIs)})
+				uris = append(uris, body.URIs...)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"snapshot_id": "snapshot"}`))
+			}))
+			defer server.Close()
+			client := NewClient(Options{BaseURL: server.URL})
+			client.Tokens = &Tokens{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}
+
+			songs := []Song{}
+			want := []string{}
+			for i := range test.songs {
+				songs = append(songs, Song{ID: fmt.Sprint(i)})
+				want = append(want, fmt.Sprintf("spotify:track:%d", i))
+			}
+			err := ReplaceSongs(t.Context(), client, "playlist", songs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(requests, test.want) {
+				t.Errorf("requests = %+v, want %+v", requests, test.want)
+			}
+			if !slices.Equal(uris, want) {
+				t.Errorf("uris = %v, want %v", uris, want)
+			}
+		})
+	}
+}
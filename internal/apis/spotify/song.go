@@ -1,18 +1,25 @@
 package spotify
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/match"
 )
 
 type Song struct {
-	ID     string
-	ISRC   string
-	Name   string
-	Artist string
+	ID     string `json:"id"`
+	ISRC   string `json:"isrc"`
+	Name   string `json:"name"`
+	Artist string `json:"artist"`
+	// Position is the index of the song in the playlist it was loaded from.
+	Position int `json:"position"`
 }
 
 type songResponse struct {
@@ -21,7 +28,12 @@ type songResponse struct {
 	Artists []struct {
 		Name string `json:"name"`
 	} `json:"artists"`
-	ExternalIDs struct {
+	Album struct {
+		Name string `json:"name"`
+	} `json:"album"`
+	DurationMillis int  `json:"duration_ms"`
+	Explicit       bool `json:"explicit"`
+	ExternalIDs    struct {
 		ISRC string `json:"isrc"`
 	} `json:"external_ids"`
 }
@@ -32,55 +44,171 @@ type searchResponse struct {
 	} `json:"tracks"`
 }
 
+// Match is the result of searching Spotify for an Apple Music song. Reason explains how the song
+// was matched or, if Found is false, why it couldn't be. Confidence is how confident the match is
+// (see match.Matcher.Confidence), or how confident the best result was if none was good enough.
+// Cached is set when the match came from a cache instead of searching.
+type Match struct {
+	Source     applemusic.Song `json:"source"`
+	Song       Song            `json:"song"`
+	Found      bool            `json:"found"`
+	Reason     string          `json:"reason"`
+	Confidence float64         `json:"confidence"`
+	Cached     bool            `json:"cached"`
+}
+
+// FindAppleMusicSongs searches Spotify for each of the Apple Music songs, first by ISRC and then by
+// name and artist if none of the ISRC results are confident enough. Several results are fetched
+// for each search and the most confident one is used, so karaoke versions, live recordings, and
+// songs by other artists aren't picked just because Spotify ranked them first. A match is returned
+// for every song, including the ones that weren't found.
 func FindAppleMusicSongs(
+	ctx context.Context,
 	client *Client,
 	appleMusicSongs []applemusic.Song,
-) ([]Song, error) {
-	songs := []Song{}
+	matcher match.Matcher,
+) ([]Match, error) {
+	matches := []Match{}
 	for _, song := range appleMusicSongs {
-		params := url.Values{
-			"q":     {fmt.Sprintf("isrc:%s", song.ISRC)},
-			"type":  {"track"},
-			"limit": {"1"},
-		}
-		resp, err := sendSpotifyAPIRequest[searchResponse](
-			client,
-			spotifyRequest{
-				Method: http.MethodGet,
-				Path:   fmt.Sprintf("/v1/search?%s", params.Encode()),
-			},
-		)
-		if err != nil {
-			return []Song{}, fmt.Errorf("%w failed to search for song with isrc of %s", err, song)
+		source := song.Candidate()
+		results := []songResponse{}
+		if song.ISRC != "" {
+			isrcResults, err := search(ctx, client, fmt.Sprintf("isrc:%s", song.ISRC), 5)
+			if err != nil {
+				return []Match{}, fmt.Errorf(
+					"%w failed to search for song with isrc of %s",
+					err,
+					song.ISRC,
+				)
+			}
+			results = isrcResults
 		}
-		if len(resp.Tracks.Items) == 0 {
 
-			params.Set("q", fmt.Sprintf("track:\"%s\" artist:\"%s\"", song.Name, song.Artist))
-			trackSearchResponse, err := sendSpotifyAPIRequest[searchResponse](
+		best, confidence, ok := bestResult(matcher, source, results)
+		if !ok {
+			// searching with the normalized name and artist finds songs even if the featured
+			// artists or remaster notes are written differently on spotify
+			nameResults, err := search(
+				ctx,
 				client,
-				spotifyRequest{
-					Method: http.MethodGet,
-					Path:   fmt.Sprintf("/v1/search?%s", params.Encode()),
-				},
+				fmt.Sprintf(
+					"track:\"%s\" artist:\"%s\"",
+					match.Name(song.Name),
+					match.Artist(song.Artist),
+				),
+				10,
 			)
 			if err != nil {
-				return []Song{}, fmt.Errorf(
+				return []Match{}, fmt.Errorf(
 					"%w failed to search for song with name of \"%s\" and artist of \"%s\"",
 					err,
 					song.Name,
 					song.Artist,
 				)
 			}
-			if len(trackSearchResponse.Tracks.Items) == 0 {
-				continue
+			results = append(results, nameResults...)
+			best, confidence, ok = bestResult(matcher, source, results)
+		}
+
+		switch {
+		case len(results) == 0:
+			reason := "no results for isrc or name and artist"
+			if song.ISRC == "" {
+				reason = "no isrc and no results for name and artist"
 			}
-			resp = trackSearchResponse
+			matches = append(matches, Match{Source: song, Reason: reason})
+		case !ok:
+			matches = append(matches, Match{
+				Source:     song,
+				Reason:     "no results above the confidence threshold",
+				Confidence: confidence,
+			})
+		default:
+			reason := "matched by name and artist"
+			if song.ISRC != "" && best.ISRC == song.ISRC {
+				reason = "matched by isrc"
+			}
+			matches = append(matches, Match{
+				Source:     song,
+				Song:       best,
+				Found:      true,
+				Reason:     reason,
+				Confidence: confidence,
+			})
 		}
-		foundSong := resp.Tracks.Items[0]
-		songs = append(
-			songs,
-			Song{ID: foundSong.ID, Artist: foundSong.Artists[0].Name, Name: foundSong.Name},
-		)
 	}
-	return songs, nil
+	return matches, nil
+}
+
+func search(ctx context.Context, client *Client, query string, limit int) ([]songResponse, error) {
+	params := url.Values{
+		"q":     {query},
+		"type":  {"track"},
+		"limit": {strconv.Itoa(limit)},
+	}
+	resp, err := sendSpotifyAPIRequest[searchResponse](
+		ctx,
+		client,
+		spotifyRequest{
+			Method: http.MethodGet,
+			Path:   fmt.Sprintf("/v1/search?%s", params.Encode()),
+		},
+	)
+	if err != nil {
+		return []songResponse{}, err
+	}
+	return resp.Tracks.Items, nil
+}
+
+// bestResult picks the search result that the matcher is most confident is the source song.
+func bestResult(
+	matcher match.Matcher,
+	source match.Candidate,
+	results []songResponse,
+) (Song, float64, bool) {
+	candidates := make([]match.Candidate, 0, len(results))
+	for _, result := range results {
+		candidates = append(candidates, result.candidate())
+	}
+	i, confidence, ok := matcher.Best(source, candidates)
+	if i == -1 {
+		return Song{}, 0, false
+	}
+	return results[i].song(), confidence, ok
+}
+
+func (s songResponse) song() Song {
+	song := Song{ID: s.ID, ISRC: s.ExternalIDs.ISRC, Name: s.Name}
+	if len(s.Artists) != 0 {
+		song.Artist = s.Artists[0].Name
+	}
+	return song
+}
+
+func (s songResponse) candidate() match.Candidate {
+	artists := make([]string, 0, len(s.Artists))
+	for _, artist := range s.Artists {
+		artists = append(artists, artist.Name)
+	}
+	return match.Candidate{
+		ISRC:     s.ExternalIDs.ISRC,
+		Name:     s.Name,
+		Artist:   strings.Join(artists, ", "),
+		Album:    s.Album.Name,
+		Duration: time.Duration(s.DurationMillis) * time.Millisecond,
+		Explicit: s.Explicit,
+	}
+}
+
+// SongByID gets the song with the given Spotify track ID.
+func SongByID(ctx context.Context, client *Client, id string) (Song, error) {
+	resp, err := sendSpotifyAPIRequest[songResponse](
+		ctx,
+		client,
+		spotifyRequest{Method: http.MethodGet, Path: fmt.Sprintf("/v1/tracks/%s", id)},
+	)
+	if err != nil {
+		return Song{}, fmt.Errorf("%w failed to get song with id of %s", err, id)
+	}
+	return resp.song(), nil
 }
@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
@@ -18,16 +19,21 @@ type Tokens struct {
 	ExpiresAt    time.Time
 }
 
-func (c *Client) Authorize() error {
+func (c *Client) Authorize(ctx context.Context) error {
+	c.mutex.RLock()
+	refreshToken := c.Tokens.RefreshToken
+	c.mutex.RUnlock()
+
 	params := url.Values{
 		"grant_type":    {"refresh_token"},
-		"refresh_token": {c.Tokens.RefreshToken},
+		"refresh_token": {refreshToken},
 		"client_id":     {secrets.ENV.SpotifyClientID},
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf("https://accounts.spotify.com/api/token?%s", params.Encode()),
+		fmt.Sprintf("%s/api/token?%s", c.accountsURL(), params.Encode()),
 		nil,
 	)
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -38,7 +44,7 @@ func (c *Client) Authorize() error {
 		return fmt.Errorf("%w creating new request failed", err)
 	}
 
-	resp, err := apis.RequestJSON[Tokens]("[spotify]", c.HttpClient, req, false)
+	resp, err := apis.RequestJSON[Tokens]("spotify", c.accounts, req, false)
 	if err != nil {
 		return fmt.Errorf("%w performing request failed", err)
 
@@ -46,9 +52,47 @@ func (c *Client) Authorize() error {
 
 	resp.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - 30*time.Second)
 
+	// spotify only sends a refresh token when it rotates it
+	if resp.RefreshToken == "" {
+		resp.RefreshToken = refreshToken
+	}
 	c.mutex.Lock()
 	c.Tokens = &resp
-	c.Tokens.RefreshToken = secrets.ENV.SpotifyRefreshToken
 	c.mutex.Unlock()
 	return nil
 }
+
+// accessToken returns the current access token, refreshing it first if it has expired. Requests
+// that find the token expired at the same time wait for a single refresh instead of each
+// refreshing it.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	tokens := c.tokens()
+	if tokens.ExpiresAt.After(time.Now()) {
+		return tokens.AccessToken, nil
+	}
+
+	return c.refreshAccessToken(ctx, tokens.AccessToken)
+}
+
+// refreshAccessToken refreshes the access token after stale expired or was rejected, unless
+// another request already refreshed it.
+func (c *Client) refreshAccessToken(ctx context.Context, stale string) (string, error) {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	// another request might have refreshed the token while this one was waiting
+	tokens := c.tokens()
+	if tokens.AccessToken != stale && tokens.ExpiresAt.After(time.Now()) {
+		return tokens.AccessToken, nil
+	}
+	err := c.Authorize(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.tokens().AccessToken, nil
+}
+
+func (c *Client) tokens() *Tokens {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Tokens
+}
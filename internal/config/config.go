@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.mattglei.ch/musicsync/internal/diff"
+	"go.mattglei.ch/musicsync/internal/match"
+)
+
+// Config holds the settings from the local config file that apply to every playlist.
+type Config struct {
+	Matching   Matching   `toml:"matching"`
+	Cache      Cache      `toml:"cache"`
+	Sync       Sync       `toml:"sync"`
+	RateLimits RateLimits `toml:"rate_limits"`
+	Guard      Guard      `toml:"guard"`
+}
+
+// Matching configures how songs are matched between Apple Music and Spotify.
+type Matching struct {
+	// Threshold is the minimum similarity (from 0 to 1) of song names and artists for them to be
+	// considered the same song.
+	Threshold float64 `toml:"threshold"`
+	// MinConfidence is the minimum confidence (from 0 to 1) that a Spotify search result needs to
+	// be added to a playlist. Songs without a result that confident are reported as unmatched.
+	MinConfidence float64 `toml:"min_confidence"`
+}
+
+// Cache configures how long the results of searching Spotify for songs are cached for. Durations
+// are strings like "720h". A duration of 0 disables caching.
+type Cache struct {
+	// TTL is how long songs that were found are cached for.
+	TTL time.Duration `toml:"ttl"`
+	// NegativeTTL is how long songs that couldn't be found are cached for before searching for
+	// them again.
+	NegativeTTL time.Duration `toml:"negative_ttl"`
+}
+
+// Sync configures how playlists are synced.
+type Sync struct {
+	// Workers is how many playlists are synced at the same time.
+	Workers int `toml:"workers"`
+	// Interval is how often playlists without their own interval or cron expression are synced.
+	Interval time.Duration `toml:"interval"`
+	// Jitter is the maximum random delay added to every scheduled sync.
+	Jitter time.Duration `toml:"jitter"`
+	// ShutdownTimeout is how long playlists that are being changed get to finish once musicsync
+	// is asked to shut down. Their changes are aborted after that.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+}
+
+// RateLimits are the maximum average requests per second sent to each API, shared between every
+// playlist that is being synced.
+type RateLimits struct {
+	Spotify    float64 `toml:"spotify"`
+	AppleMusic float64 `toml:"apple_music"`
+}
+
+// Guard configures the limits on how many songs a sync can remove from a Spotify playlist. Syncs
+// over either limit are refused unless they are forced. A limit of 0 disables it.
+type Guard struct {
+	// MaxRemovals is the most songs a sync can remove.
+	MaxRemovals int `toml:"max_removals"`
+	// MaxRemovalPercent is the most of a playlist (from 0 to 100) that a sync can remove.
+	MaxRemovalPercent float64 `toml:"max_removal_percent"`
+}
+
+// Default returns the config used when there is no config file.
+func Default() Config {
+	return Config{
+		Matching: Matching{
+			Threshold:     match.DefaultThreshold,
+			MinConfidence: match.DefaultConfidence,
+		},
+		Cache: Cache{
+			TTL:         30 * 24 * time.Hour,
+			NegativeTTL: 24 * time.Hour,
+		},
+		Sync: Sync{
+			Workers:         4,
+			Interval:        15 * time.Minute,
+			Jitter:          time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		RateLimits: RateLimits{
+			Spotify:    2,
+			AppleMusic: 2,
+		},
+		Guard: Guard{
+			MaxRemovals:       50,
+			MaxRemovalPercent: 50,
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults. A missing file is not an error.
+func Load(path string) (Config, error) {
+	config := Default()
+	_, err := toml.DecodeFile(path, &config)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("%w failed to decode %s", err, path)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("%w invalid config in %s", err, path)
+	}
+	return config, nil
+}
+
+// Validate checks that every setting is within its allowed range.
+func (c Config) Validate() error {
+	if c.Matching.Threshold <= 0 || c.Matching.Threshold > 1 {
+		return fmt.Errorf(
+			"matching threshold must be above 0 and at most 1, got %v",
+			c.Matching.Threshold,
+		)
+	}
+	if c.Matching.MinConfidence <= 0 || c.Matching.MinConfidence > 1 {
+		return fmt.Errorf(
+			"matching min_confidence must be above 0 and at most 1, got %v",
+			c.Matching.MinConfidence,
+		)
+	}
+	if c.Cache.TTL < 0 || c.Cache.NegativeTTL < 0 {
+		return errors.New("cache durations can't be negative")
+	}
+	if c.Sync.Workers < 1 {
+		return fmt.Errorf("sync workers must be at least 1, got %d", c.Sync.Workers)
+	}
+	if c.Sync.Interval < time.Second {
+		return fmt.Errorf("sync interval must be at least a second, got %s", c.Sync.Interval)
+	}
+	if c.Sync.Jitter < 0 {
+		return errors.New("sync jitter can't be negative")
+	}
+	if c.Sync.ShutdownTimeout < 0 {
+		return errors.New("sync shutdown_timeout can't be negative")
+	}
+	if c.RateLimits.Spotify <= 0 || c.RateLimits.AppleMusic <= 0 {
+		return errors.New("rate limits must be above 0")
+	}
+	if c.Guard.MaxRemovals < 0 {
+		return fmt.Errorf("guard max_removals can't be negative, got %d", c.Guard.MaxRemovals)
+	}
+	if c.Guard.MaxRemovalPercent < 0 || c.Guard.MaxRemovalPercent > 100 {
+		return fmt.Errorf(
+			"guard max_removal_percent must be from 0 to 100, got %v",
+			c.Guard.MaxRemovalPercent,
+		)
+	}
+	return nil
+}
+
+// Guard creates the guard that limits removals for the guard settings.
+func (g Guard) Guard() diff.Guard {
+	return diff.Guard{MaxRemovals: g.MaxRemovals, MaxRemovalPercent: g.MaxRemovalPercent}
+}
+
+// Matcher creates the song matcher for the matching settings.
+func (m Matching) Matcher() match.Matcher {
+	return match.Matcher{Threshold: m.Threshold, MinConfidence: m.MinConfidence}
+}
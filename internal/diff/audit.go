@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// audit records changes that were made to the playlist in the audit log. Failing to write them
+// only logs a warning since the changes have already been made.
+func (e Executor) audit(plan Plan, entries []store.AuditEntry) {
+	if e.Audit == nil {
+		return
+	}
+	err := e.Audit.Append(entries...)
+	if err != nil {
+		timber.Warning(logPrefix(plan.Playlist), "failed to write to audit log", err.Error())
+	}
+}
+
+func (p Plan) removalEntries(now time.Time) []store.AuditEntry {
+	entries := make([]store.AuditEntry, 0, len(p.Removals))
+	for _, removal := range p.Removals {
+		entry := p.auditEntry(now, store.AuditRemove, string(removal.Reason))
+		entry.Name = removal.Song.Name
+		entry.Artist = removal.Song.Artist
+		entry.ISRC = removal.Song.ISRC
+		entry.TrackID = removal.Song.ID
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (p Plan) additionEntries(now time.Time) []store.AuditEntry {
+	entries := make([]store.AuditEntry, 0, len(p.Additions))
+	for _, addition := range p.Additions {
+		entry := p.auditEntry(now, store.AuditAdd, string(addition.Reason))
+		entry.Name = addition.Match.Name
+		entry.Artist = addition.Match.Artist
+		entry.ISRC = addition.Match.ISRC
+		entry.TrackID = addition.Match.ID
+		entry.MatchedBy = addition.MatchedBy
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (p Plan) appleMusicAdditionEntries(now time.Time) []store.AuditEntry {
+	entries := make([]store.AuditEntry, 0, len(p.AppleMusicAdditions))
+	for _, addition := range p.AppleMusicAdditions {
+		entry := p.auditEntry(now, store.AuditAddToAppleMusic, string(addition.Reason))
+		entry.Name = addition.Match.Name
+		entry.Artist = addition.Match.Artist
+		entry.ISRC = addition.Match.ISRC
+		entry.TrackID = addition.Match.ID
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (p Plan) auditEntry(now time.Time, action store.AuditAction, reason string) store.AuditEntry {
+	return store.AuditEntry{
+		Time:         now,
+		Playlist:     p.Playlist,
+		AppleMusicID: p.AppleMusicID,
+		SpotifyID:    p.SpotifyID,
+		Action:       action,
+		Reason:       reason,
+		SnapshotID:   p.SnapshotID,
+	}
+}
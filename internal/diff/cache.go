@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// findSongs searches Spotify for the Apple Music songs like spotify.FindAppleMusicSongs but only
+// searches for the songs that don't have a fresh match in the cache. The results of the new
+// searches are saved to the cache.
+func (e Executor) findSongs(ctx context.Context, songs []applemusic.Song) ([]spotify.Match, error) {
+	if e.Cache == nil {
+		return spotify.FindAppleMusicSongs(ctx, e.Spotify, songs, e.Matcher)
+	}
+
+	cached, err := e.Cache.File.Load()
+	if err != nil {
+		return []spotify.Match{}, fmt.Errorf("%w failed to load match cache", err)
+	}
+
+	var (
+		now       = time.Now()
+		matches   = make([]spotify.Match, len(songs))
+		toSearch  []applemusic.Song
+		positions []int
+	)
+	for i, song := range songs {
+		entry, ok := cached[store.MatchKey(song)]
+		if ok && e.Cache.Fresh(entry, now) {
+			match := entry.Match
+			match.Source = song
+			match.Cached = true
+			matches[i] = match
+			continue
+		}
+		toSearch = append(toSearch, song)
+		positions = append(positions, i)
+	}
+	if hits := len(songs) - len(toSearch); hits != 0 {
+		timber.Info("Found", hits, "songs in the match cache")
+	}
+	if len(toSearch) == 0 {
+		return matches, nil
+	}
+
+	found, err := spotify.FindAppleMusicSongs(ctx, e.Spotify, toSearch, e.Matcher)
+	if err != nil {
+		return []spotify.Match{}, err
+	}
+	for i, match := range found {
+		matches[positions[i]] = match
+	}
+
+	err = e.Cache.File.Update(func(cache *store.Matches) error {
+		if *cache == nil {
+			*cache = store.Matches{}
+		}
+		for _, match := range found {
+			key := store.MatchKey(match.Source)
+			if key != "" {
+				(*cache)[key] = store.CachedMatch{Match: match, CachedAt: now}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []spotify.Match{}, fmt.Errorf("%w failed to save match cache", err)
+	}
+	return matches, nil
+}
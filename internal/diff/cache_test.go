@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+func TestFindSongsCache(t *testing.T) {
+	var (
+		now  = time.Now()
+		song = applemusic.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"}
+		key  = store.MatchKey(song)
+	)
+	tests := []struct {
+		name string
+		// cached is how long ago the song was cached, if it was
+		cached   time.Duration
+		found    bool
+		onSearch bool
+		// wantSearch is if spotify is searched for the song
+		wantSearch bool
+		wantFound  bool
+	}{
+		{name: "not cached", onSearch: true, wantSearch: true, wantFound: true},
+		{
+			name:       "fresh negative entry",
+			cached:     time.Hour,
+			onSearch:   true,
+			wantSearch: false,
+			wantFound:  false,
+		},
+		{
+			name:       "expired negative entry replaced by a match",
+			cached:     48 * time.Hour,
+			onSearch:   true,
+			wantSearch: true,
+			wantFound:  true,
+		},
+		{
+			name:       "expired negative entry still not found",
+			cached:     48 * time.Hour,
+			onSearch:   false,
+			wantSearch: true,
+			wantFound:  false,
+		},
+		{
+			name:       "fresh positive entry",
+			cached:     48 * time.Hour,
+			found:      true,
+			wantSearch: false,
+			wantFound:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestSync(t)
+			if test.onSearch {
+				s.spotify.AddTracks(
+					fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+				)
+			}
+			s.executor.Cache = &store.MatchCache{
+				File: &store.File[store.Matches]{
+					Path: filepath.Join(t.TempDir(), "matches.json"),
+				},
+				TTL:         30 * 24 * time.Hour,
+				NegativeTTL: 24 * time.Hour,
+			}
+			if test.cached != 0 {
+				match := store.CachedMatch{CachedAt: now.Add(-test.cached)}
+				match.Match.Source = song
+				match.Match.Found = test.found
+				if test.found {
+					match.Match.Song.ID = "one"
+				}
+				err := s.executor.Cache.File.Save(store.Matches{key: match})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			matches, err := s.executor.findSongs(t.Context(), []applemusic.Song{song})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if searched := len(s.sent(http.MethodGet)) != 0; searched != test.wantSearch {
+				t.Errorf("searched = %t, want %t", searched, test.wantSearch)
+			}
+			if len(matches) != 1 || matches[0].Found != test.wantFound {
+				t.Fatalf("matches = %+v, want found = %t", matches, test.wantFound)
+			}
+			if matches[0].Source != song {
+				t.Errorf("source = %+v, want %+v", matches[0].Source, song)
+			}
+
+			cached, err := s.executor.Cache.File.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, ok := cached[key]
+			if !ok || entry.Match.Found != test.wantFound {
+				t.Errorf("cached %+v, want found = %t", entry, test.wantFound)
+			}
+			if test.wantSearch && !entry.CachedAt.After(now) {
+				t.Errorf("new search result wasn't cached again")
+			}
+		})
+	}
+}
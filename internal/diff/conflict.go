@@ -0,0 +1,70 @@
+package diff
+
+import "go.mattglei.ch/musicsync/internal/match"
+
+// ConflictPolicy decides which side wins when a song was removed from one playlist since the last
+// sync while it is still in the other one.
+type ConflictPolicy string
+
+const (
+	// AppleMusicWins mirrors removals from Apple Music to Spotify and restores songs that were
+	// removed from Spotify. This is the default.
+	AppleMusicWins ConflictPolicy = "apple_music"
+	// SpotifyWins restores songs that were removed from Apple Music and leaves songs that were
+	// removed from Spotify out of Spotify. Apple Music's API doesn't support removing songs from a
+	// library playlist so those songs stay in Apple Music.
+	SpotifyWins ConflictPolicy = "spotify"
+	// KeepBoth restores removed songs on whichever side they were removed from.
+	KeepBoth ConflictPolicy = "keep"
+)
+
+// Valid reports if the policy is one of the known policies. An empty policy is valid and means
+// AppleMusicWins.
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case "", AppleMusicWins, SpotifyWins, KeepBoth:
+		return true
+	default:
+		return false
+	}
+}
+
+// SongKey identifies a song across both services for the sync state. The ISRC is used when
+// present, falling back to the normalized name and artist.
+func SongKey(isrc string, name string, artist string) string {
+	if isrc != "" {
+		return isrc
+	}
+	return match.Key(name, artist)
+}
+
+// StateKeys returns the keys of every song that will be in both playlists once the plan is
+// applied, to be stored as the previous songs for the next plan of the playlist. Songs that the
+// conflict policy keeps out of one playlist are included so it keeps applying to them. Songs that
+// are only in one playlist because they couldn't be found in the other aren't, so they're looked
+// for again instead of being treated as removed. The keys are never nil, even for empty playlists,
+// which tells the next plan that the playlist has been synced bidirectionally before.
+func (p Plan) StateKeys() []string {
+	var (
+		keys = []string{}
+		seen = map[string]bool{}
+	)
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range p.known {
+		add(key)
+	}
+	for _, addition := range p.Additions {
+		add(SongKey(addition.Source.ISRC, addition.Source.Name, addition.Source.Artist))
+		add(SongKey(addition.Match.ISRC, addition.Match.Name, addition.Match.Artist))
+	}
+	for _, addition := range p.AppleMusicAdditions {
+		add(SongKey(addition.Source.ISRC, addition.Source.Name, addition.Source.Artist))
+		add(SongKey(addition.Match.ISRC, addition.Match.Name, addition.Match.Artist))
+	}
+	return keys
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+)
+
+func TestFirstBidirectionalSyncIsOneWay(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "2", ISRC: "ISRC2", Name: "Two", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "two")
+
+	plan := s.sync(Input{Bidirectional: true})
+	if len(plan.AppleMusicAdditions) != 0 {
+		t.Errorf("first sync added %v to apple music", plan.AppleMusicAdditions)
+	}
+	if len(plan.Removals) != 1 || plan.Removals[0].Reason != ReasonNotInAppleMusic {
+		t.Errorf("first sync removals = %v, want two not in apple music", plan.Removals)
+	}
+	if got := s.appleMusicPlaylist(); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("apple music playlist = %v, want [1]", got)
+	}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, []string{"one"}) {
+		t.Errorf("spotify playlist = %v, want [one]", got)
+	}
+	if !slices.Equal(s.previous, []string{"ISRC1"}) {
+		t.Errorf("state = %v, want [ISRC1]", s.previous)
+	}
+}
+
+func TestStateKeysSkipSongsOnlyOnOneSide(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "3", ISRC: "ISRC3", Name: "Three", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		// a local file without an isrc and a song that isn't in the apple music catalog
+		fake.Track{ID: "local", Name: "Local", Artists: []string{"Someone"}},
+		fake.Track{ID: "missing", ISRC: "ISRC9", Name: "Missing", Artists: []string{"Other"}},
+		fake.Track{ID: "three", ISRC: "ISRC3", Name: "Three", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one")
+	s.sync(Input{Bidirectional: true})
+
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "local", "missing", "three")
+	plan := s.sync(Input{Bidirectional: true})
+	if len(plan.AppleMusicAdditions) != 1 || plan.AppleMusicAdditions[0].Match.ID != "3" {
+		t.Errorf("apple music additions = %v, want only three", plan.AppleMusicAdditions)
+	}
+	if !slices.Equal(s.previous, []string{"ISRC1", "ISRC3"}) {
+		t.Errorf("state = %v, want [ISRC1 ISRC3]", s.previous)
+	}
+
+	// the songs that couldn't be added to apple music are looked for again instead of being
+	// removed as if they were removed from apple music
+	plan = s.sync(Input{Bidirectional: true})
+	if len(plan.Removals) != 0 {
+		t.Errorf("removals = %v, want none", plan.Removals)
+	}
+	// three is moved to match the order of apple music
+	want := []string{"one", "three", "local", "missing"}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, want) {
+		t.Errorf("spotify playlist = %v, want %v", got, want)
+	}
+}
+
+func TestStateKeysKeepSongsLeftOutByConflictPolicy(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "2", ISRC: "ISRC2", Name: "Two", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "2")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "two")
+	s.sync(Input{Bidirectional: true, ConflictPolicy: SpotifyWins})
+
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one")
+	for range 2 {
+		plan := s.sync(Input{Bidirectional: true, ConflictPolicy: SpotifyWins})
+		if len(plan.Additions) != 0 {
+			t.Errorf("additions = %v, want none", plan.Additions)
+		}
+		if !slices.Contains(s.previous, "ISRC2") {
+			t.Errorf("state = %v, want it to keep ISRC2", s.previous)
+		}
+	}
+}
+
+func TestStateKeysNeverNil(t *testing.T) {
+	if (Plan{}).StateKeys() == nil {
+		t.Error("state keys of an empty plan are nil")
+	}
+}
@@ -3,41 +3,50 @@ package diff
 import (
 	"go.mattglei.ch/musicsync/internal/apis/applemusic"
 	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
 )
 
+// PlaylistDiff returns the Apple Music songs that are missing from the Spotify playlist and the
+// Spotify songs that aren't in the Apple Music playlist. Two songs are the same if they have the
+// same ISRC or similar enough names and artists (see matchSongs). Songs are counted, so a song
+// that is in the Apple Music playlist twice but in the Spotify playlist once is returned once to
+// be added, and extra copies of a song in the Spotify playlist are returned (with their
+// positions) to be removed.
 func PlaylistDiff(
 	appleMusicSongs []applemusic.Song,
 	spotifySongs []spotify.Song,
+	matcher match.Matcher,
+) ([]applemusic.Song, []spotify.Song) {
+	return splitMatches(
+		appleMusicSongs,
+		spotifySongs,
+		matchSongs(appleMusicSongs, spotifySongs, matcher, nil),
+	)
+}
+
+// splitMatches returns the songs that weren't paired by matchSongs, like PlaylistDiff.
+func splitMatches(
+	appleMusicSongs []applemusic.Song,
+	spotifySongs []spotify.Song,
+	matches []int,
 ) ([]applemusic.Song, []spotify.Song) {
 	var (
 		toAdd    []applemusic.Song
 		toDelete []spotify.Song
+		matched  = make([]bool, len(appleMusicSongs))
 	)
 
-	for _, appleMusicSong := range appleMusicSongs {
-		contains := false
-		for _, spotifySong := range spotifySongs {
-			if spotifySong.ISRC == appleMusicSong.ISRC ||
-				(spotifySong.Name == appleMusicSong.Name && spotifySong.Artist == appleMusicSong.Artist) {
-				contains = true
-				break
-			}
-		}
-		if !contains {
-			toAdd = append(toAdd, appleMusicSong)
+	for i, match := range matches {
+		if match == -1 {
+			toDelete = append(toDelete, spotifySongs[i])
+			continue
 		}
+		matched[match] = true
 	}
 
-	for _, spotifySong := range spotifySongs {
-		contains := false
-		for _, appleMusicSong := range appleMusicSongs {
-			if spotifySong.ISRC == appleMusicSong.ISRC ||
-				(spotifySong.Name == appleMusicSong.Name && spotifySong.Artist == appleMusicSong.Artist) {
-				contains = true
-			}
-		}
-		if !contains {
-			toDelete = append(toDelete, spotifySong)
+	for i, appleMusicSong := range appleMusicSongs {
+		if !matched[i] {
+			toAdd = append(toAdd, appleMusicSong)
 		}
 	}
 
@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
+)
+
+func TestPlaylistDiffSongsWithoutISRCs(t *testing.T) {
+	// comparing isrcs directly used to match any two songs without one, so a song without an isrc
+	// was never added as long as the spotify playlist had another song without one
+	appleMusicSongs := []applemusic.Song{{Name: "Intro", Artist: "Band"}}
+	spotifySongs := []spotify.Song{{ID: "1", Name: "Outro", Artist: "Other Band"}}
+
+	toAdd, toDelete := PlaylistDiff(appleMusicSongs, spotifySongs, match.Matcher{})
+	if len(toAdd) != 1 || toAdd[0].Name != "Intro" {
+		t.Errorf("to add = %v, want intro", toAdd)
+	}
+	if len(toDelete) != 1 || toDelete[0].Name != "Outro" {
+		t.Errorf("to delete = %v, want outro", toDelete)
+	}
+
+	// songs without isrcs still match by name and artist
+	spotifySongs = []spotify.Song{{ID: "1", Name: "Intro", Artist: "Band"}}
+	toAdd, toDelete = PlaylistDiff(appleMusicSongs, spotifySongs, match.Matcher{})
+	if len(toAdd) != 0 || len(toDelete) != 0 {
+		t.Errorf("to add = %v and to delete = %v, want neither", toAdd, toDelete)
+	}
+}
+
+// benchmarkPlaylists creates playlists with n songs each where every 20th song is only in one of
+// them and every 10th song doesn't have an ISRC, in a different order on each side.
+func benchmarkPlaylists(n int) ([]applemusic.Song, []spotify.Song) {
+	appleMusicSongs := make([]applemusic.Song, 0, n)
+	spotifySongs := make([]spotify.Song, 0, n)
+	for i := range n {
+		isrc := fmt.Sprintf("USABC%07d", i)
+		if i%10 == 0 {
+			isrc = ""
+		}
+		name, artist := fmt.Sprintf("Song %d", i), fmt.Sprintf("Artist %d", i%500)
+		if i%20 == 5 {
+			name, isrc = "Apple Music "+name, "AM"+isrc
+		}
+		appleMusicSongs = append(appleMusicSongs, applemusic.Song{
+			ISRC:   isrc,
+			Name:   name,
+			Artist: artist,
+		})
+
+		j := (i * 7919) % n
+		isrc = fmt.Sprintf("USABC%07d", j)
+		if j%10 == 0 {
+			isrc = ""
+		}
+		name, artist = fmt.Sprintf("Song %d", j), fmt.Sprintf("Artist %d", j%500)
+		if j%20 == 15 {
+			name, isrc = "Spotify "+name, "SP"+isrc
+		}
+		spotifySongs = append(spotifySongs, spotify.Song{
+			ID:     fmt.Sprint(j),
+			ISRC:   isrc,
+			Name:   name,
+			Artist: artist,
+		})
+	}
+	return appleMusicSongs, spotifySongs
+}
+
+func BenchmarkPlaylistDiff(b *testing.B) {
+	appleMusicSongs, spotifySongs := benchmarkPlaylists(10_000)
+	b.Run("indexed", func(b *testing.B) {
+		for b.Loop() {
+			PlaylistDiff(appleMusicSongs, spotifySongs, match.Matcher{})
+		}
+	})
+	b.Run("nested loops", func(b *testing.B) {
+		for b.Loop() {
+			nestedPlaylistDiff(appleMusicSongs, spotifySongs)
+		}
+	})
+}
+
+// nestedPlaylistDiff is how PlaylistDiff compared every pair of songs before it used indexes, to
+// compare their performance against.
+func nestedPlaylistDiff(
+	appleMusicSongs []applemusic.Song,
+	spotifySongs []spotify.Song,
+) ([]applemusic.Song, []spotify.Song) {
+	var (
+		toAdd    []applemusic.Song
+		toDelete []spotify.Song
+	)
+	same := func(appleMusicSong applemusic.Song, spotifySong spotify.Song) bool {
+		return spotifySong.ISRC == appleMusicSong.ISRC ||
+			(spotifySong.Name == appleMusicSong.Name && spotifySong.Artist == appleMusicSong.Artist)
+	}
+	for _, appleMusicSong := range appleMusicSongs {
+		contains := false
+		for _, spotifySong := range spotifySongs {
+			if same(appleMusicSong, spotifySong) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			toAdd = append(toAdd, appleMusicSong)
+		}
+	}
+	for _, spotifySong := range spotifySongs {
+		contains := false
+		for _, appleMusicSong := range appleMusicSongs {
+			if same(appleMusicSong, spotifySong) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			toDelete = append(toDelete, spotifySong)
+		}
+	}
+	return toAdd, toDelete
+}
+
+func TestPlaylistDiffDuplicates(t *testing.T) {
+	tests := []struct {
+		name       string
+		appleMusic []string
+		spotify    []string
+		toAdd      []string
+		// toDelete are the positions of the Spotify songs to delete
+		toDelete []int
+	}{
+		{
+			name:       "duplicates only in apple music",
+			appleMusic: []string{"A", "B", "A", "A"},
+			spotify:    []string{"A", "B"},
+			toAdd:      []string{"A", "A"},
+			toDelete:   []int{},
+		},
+		{
+			name:       "duplicates only in spotify",
+			appleMusic: []string{"A", "B"},
+			spotify:    []string{"A", "A", "B", "A"},
+			toAdd:      []string{},
+			toDelete:   []int{1, 3},
+		},
+		{
+			name:       "more copies in apple music",
+			appleMusic: []string{"A", "A", "A", "B"},
+			spotify:    []string{"B", "A", "A"},
+			toAdd:      []string{"A"},
+			toDelete:   []int{},
+		},
+		{
+			name:       "more copies in spotify",
+			appleMusic: []string{"A", "B", "A"},
+			spotify:    []string{"A", "A", "A", "B", "A"},
+			toAdd:      []string{},
+			toDelete:   []int{2, 4},
+		},
+		{
+			name:       "duplicates of different songs on each side",
+			appleMusic: []string{"A", "A", "B"},
+			spotify:    []string{"A", "B", "B"},
+			toAdd:      []string{"A"},
+			toDelete:   []int{2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appleMusicSongs, spotifySongs := testPlaylists(test.appleMusic, test.spotify)
+			toAdd, toDelete := PlaylistDiff(appleMusicSongs, spotifySongs, match.Matcher{})
+
+			added := []string{}
+			for _, song := range toAdd {
+				added = append(added, song.ISRC)
+			}
+			if !slices.Equal(added, test.toAdd) {
+				t.Errorf("to add = %v, want %v", added, test.toAdd)
+			}
+			deleted := []int{}
+			for _, song := range toDelete {
+				deleted = append(deleted, song.Position)
+			}
+			if !slices.Equal(deleted, test.toDelete) {
+				t.Errorf("to delete = %v, want positions %v", deleted, test.toDelete)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// Apply makes every change in the plan. Reorders are applied against the playlist as it is after
+// the removals and additions, which is the order they were planned against. Nothing is changed if
+// the plan removes more songs than the guard allows. The snapshot ID of the Spotify playlist after
+// the last change to its songs is returned, which is the snapshot ID of the plan if the songs
+// weren't changed.
+func (e Executor) Apply(ctx context.Context, plan Plan) (string, error) {
+	err := e.Guard.Check(plan)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := logPrefix(plan.Playlist)
+	changesSpotify := len(plan.Removals) != 0 || len(plan.Additions) != 0 ||
+		len(plan.Reorders) != 0 || len(plan.Metadata) != 0
+	if e.Snapshots != nil && changesSpotify {
+		err = e.Snapshots.Update(func(snapshots *store.Snapshots) error {
+			snapshots.Add(plan.SpotifyID, plan.Playlist, store.Snapshot{
+				TakenAt:    time.Now(),
+				SnapshotID: plan.SnapshotID,
+				Songs:      plan.SpotifySongs,
+			})
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("%w failed to save snapshot of playlist", err)
+		}
+		timber.Done(prefix, "Saved snapshot of SPOTIFY playlist")
+	}
+	snapshotID := plan.SnapshotID
+	if len(plan.Removals) != 0 {
+		timber.Info(prefix, "Deleting", len(plan.Removals), "songs")
+		songs := []spotify.Song{}
+		for _, removal := range plan.Removals {
+			timber.Infof("%s - \"%s\" by \"%s\"", prefix, removal.Song.Name, removal.Song.Artist)
+			songs = append(songs, removal.Song)
+		}
+		snapshotID, err = spotify.EditSongs(ctx, e.Spotify, plan.SpotifyID, songs, &snapshotID)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to remove songs from playlist", err)
+		}
+		e.audit(plan, plan.removalEntries(time.Now()))
+		timber.Done(prefix, "[7/10]", "Removed", len(plan.Removals), "songs")
+	} else {
+		timber.Info(prefix, "[7/10] Skipped as there are no songs to remove")
+	}
+
+	if len(plan.Additions) != 0 {
+		timber.Info(prefix, "Adding", len(plan.Additions), "songs")
+		songs := []spotify.Song{}
+		for _, addition := range plan.Additions {
+			timber.Infof("%s + \"%s\" by \"%s\"", prefix, addition.Match.Name, addition.Match.Artist)
+			songs = append(songs, addition.Match)
+		}
+		snapshotID, err = spotify.EditSongs(ctx, e.Spotify, plan.SpotifyID, songs, nil)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to add songs to playlist", err)
+		}
+		e.audit(plan, plan.additionEntries(time.Now()))
+		timber.Done(prefix, "[8/10]", "Added", len(plan.Additions), "songs")
+	} else {
+		timber.Info(prefix, "[8/10] Skipped as there are no songs to add")
+	}
+
+	if len(plan.AppleMusicAdditions) != 0 {
+		timber.Info(prefix, "Adding", len(plan.AppleMusicAdditions), "songs to APPLE MUSIC")
+		songs := []applemusic.Song{}
+		for _, addition := range plan.AppleMusicAdditions {
+			timber.Infof("%s + \"%s\" by \"%s\"", prefix, addition.Match.Name, addition.Match.Artist)
+			songs = append(songs, addition.Match)
+		}
+		err := applemusic.AddSongs(ctx, e.AppleMusic, plan.AppleMusicID, songs)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to add songs to apple music playlist", err)
+		}
+		e.audit(plan, plan.appleMusicAdditionEntries(time.Now()))
+		timber.Done(prefix, "Added", len(plan.AppleMusicAdditions), "songs to APPLE MUSIC")
+	}
+
+	if len(plan.Reorders) != 0 {
+		timber.Info(prefix, "Moving", len(plan.Reorders), "groups of songs")
+		for _, move := range plan.Reorders {
+			timber.Infof(
+				"%s ~ %s from %d to %d",
+				prefix,
+				move.Summary(),
+				move.RangeStart,
+				move.InsertBefore,
+			)
+			err := spotify.MoveSongs(
+				ctx,
+				e.Spotify,
+				plan.SpotifyID,
+				move.RangeStart,
+				move.RangeLength,
+				move.InsertBefore,
+				&snapshotID,
+			)
+			if err != nil {
+				return "", fmt.Errorf("%w failed to move songs in playlist", err)
+			}
+		}
+		timber.Done(prefix, "[9/10]", "Moved", len(plan.Reorders), "groups of songs")
+	} else {
+		timber.Info(prefix, "[9/10] Skipped as the playlist is already in order")
+	}
+
+	if len(plan.Metadata) == 0 {
+		timber.Info(prefix, "[10/10] Skipped as there is no playlist metadata to update")
+	}
+	// spotify doesn't respond with a snapshot id for changes to the details of a playlist, which
+	// don't change its songs, so the snapshot id from the last change to the songs is kept
+	for _, update := range plan.Metadata {
+		switch update.Field {
+		case "description":
+			err := spotify.UpdateDescription(ctx, e.Spotify, plan.SpotifyID, update.Value)
+			if err != nil {
+				return "", fmt.Errorf("%w failed to update playlist description", err)
+			}
+			timber.Info(prefix, "[10/10] Updated playlist description")
+		default:
+			return "", fmt.Errorf("unknown playlist metadata field %q", update.Field)
+		}
+	}
+
+	return snapshotID, nil
+}
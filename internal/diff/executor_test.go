@@ -0,0 +1,321 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis"
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+const (
+	testAppleMusicPlaylist = "p.apple"
+	testSpotifyPlaylist    = "spotify"
+)
+
+// testSync syncs a playlist between fakes of Spotify and Apple Music, keeping the state between
+// syncs like the daemon does. Every request sent to Spotify is recorded.
+type testSync struct {
+	t          *testing.T
+	spotify    *fake.Spotify
+	appleMusic *fake.AppleMusic
+	executor   Executor
+	previous   []string
+
+	mutex    sync.Mutex
+	requests []recordedRequest
+}
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+func newTestSync(t *testing.T) *testSync {
+	t.Helper()
+	s := &testSync{t: t, spotify: fake.NewSpotify("refresh-token"), appleMusic: fake.NewAppleMusic()}
+	t.Cleanup(s.spotify.Close)
+	t.Cleanup(s.appleMusic.Close)
+	s.executor = Executor{
+		AppleMusic: s.appleMusic.Client(),
+		Spotify: spotify.NewClient(spotify.Options{
+			Transport:    apis.RoundTripperFunc(s.record),
+			RefreshToken: "refresh-token",
+			BaseURL:      s.spotify.URL,
+			AccountsURL:  s.spotify.URL,
+		}),
+	}
+	err := s.executor.Spotify.Authorize(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// plan plans the sync of the playlists with the given settings. Previous is set to the state from
+// the last sync.
+func (s *testSync) plan(input Input) Plan {
+	s.t.Helper()
+	ctx := s.t.Context()
+	ids, err := applemusic.PlaylistSongs(ctx, s.executor.AppleMusic, testAppleMusicPlaylist)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	input.AppleMusicSongs, err = applemusic.PlaylistISRCs(ctx, s.executor.AppleMusic, ids)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	input.SnapshotID, err = spotify.PlaylistSnapshot(ctx, s.executor.Spotify, testSpotifyPlaylist)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	input.SpotifySongs, err = spotify.PlaylistSongs(ctx, s.executor.Spotify, testSpotifyPlaylist)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	input.Playlist = "test"
+	input.AppleMusicID = testAppleMusicPlaylist
+	input.SpotifyID = testSpotifyPlaylist
+	input.Previous = s.previous
+
+	plan, err := s.executor.Plan(ctx, input)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return plan
+}
+
+// sync plans and applies the sync of the playlists and saves the state for the next sync.
+func (s *testSync) sync(input Input) Plan {
+	s.t.Helper()
+	plan := s.plan(input)
+	_, err := s.executor.Apply(s.t.Context(), plan)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if input.Bidirectional {
+		s.previous = plan.StateKeys()
+	}
+	return plan
+}
+
+func (s *testSync) record(req *http.Request) (*http.Response, error) {
+	recorded := recordedRequest{Method: req.Method, Path: req.URL.Path}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = body
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	s.mutex.Lock()
+	s.requests = append(s.requests, recorded)
+	s.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// sent returns the requests sent to Spotify with the method.
+func (s *testSync) sent(method string) []recordedRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	requests := []recordedRequest{}
+	for _, req := range s.requests {
+		if req.Method == method {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func (s *testSync) spotifyPlaylist() []string {
+	s.t.Helper()
+	ids, _, ok := s.spotify.Playlist(testSpotifyPlaylist)
+	if !ok {
+		s.t.Fatal("spotify playlist doesn't exist")
+	}
+	return ids
+}
+
+func (s *testSync) appleMusicPlaylist() []string {
+	s.t.Helper()
+	ids, ok := s.appleMusic.Playlist(testAppleMusicPlaylist)
+	if !ok {
+		s.t.Fatal("apple music playlist doesn't exist")
+	}
+	return ids
+}
+
+func TestApplyRemovesDuplicatesByPosition(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "3", ISRC: "ISRC3", Name: "Three", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+		fake.Track{ID: "three", ISRC: "ISRC3", Name: "Three", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "3")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "two", "one", "three", "one")
+
+	plan := s.sync(Input{})
+	deletes := s.sent(http.MethodDelete)
+	if len(deletes) != 1 {
+		t.Fatalf("sent %d deletes, want 1", len(deletes))
+	}
+	var body struct {
+		Tracks []struct {
+			URI       string `json:"uri"`
+			Positions []int  `json:"positions"`
+		} `json:"tracks"`
+		SnapshotID string `json:"snapshot_id"`
+	}
+	err := json.Unmarshal(deletes[0].Body, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.SnapshotID != plan.SnapshotID || body.SnapshotID == "" {
+		t.Errorf("deleted from snapshot %q, want %q", body.SnapshotID, plan.SnapshotID)
+	}
+	// the first copy of one is kept and the others are removed from where they are
+	want := map[string][]int{"spotify:track:two": {1}, "spotify:track:one": {2, 4}}
+	if len(body.Tracks) != len(want) {
+		t.Errorf("deleted %+v, want %v", body.Tracks, want)
+	}
+	for _, track := range body.Tracks {
+		if !slices.Equal(track.Positions, want[track.URI]) {
+			t.Errorf("deleted %s at %v, want %v", track.URI, track.Positions, want[track.URI])
+		}
+	}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, []string{"one", "three"}) {
+		t.Errorf("spotify playlist = %v, want [one three]", got)
+	}
+}
+
+func TestApplyRemovesInBatches(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "3", ISRC: "ISRC3", Name: "Three", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+		fake.Track{ID: "three", ISRC: "ISRC3", Name: "Three", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "3")
+	trackIDs := []string{"one"}
+	for range 150 {
+		trackIDs = append(trackIDs, "two", "three")
+	}
+	s.spotify.SetPlaylist(testSpotifyPlaylist, trackIDs...)
+
+	// 299 songs are removed in 3 batches, each sent against the snapshot from the one before
+	s.sync(Input{})
+	deletes := s.sent(http.MethodDelete)
+	if len(deletes) != 3 {
+		t.Fatalf("sent %d deletes, want 3", len(deletes))
+	}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, []string{"one", "three"}) {
+		t.Errorf("spotify playlist = %v, want [one three]", got)
+	}
+}
+
+func TestApplyStaleSnapshot(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"})
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "two")
+
+	plan := s.plan(Input{})
+	// the playlist changes after it was planned so the positions of the songs could be wrong
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "two", "one")
+	_, err := s.executor.Apply(t.Context(), plan)
+	if !apis.HasStatus(err, http.StatusBadRequest) {
+		t.Fatalf("Apply() error = %v, want %d", err, http.StatusBadRequest)
+	}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, []string{"two", "one"}) {
+		t.Errorf("spotify playlist = %v, want [two one]", got)
+	}
+}
+
+func TestSyncKeepsAppleMusicDuplicates(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+		fake.Song{ID: "3", ISRC: "ISRC3", Name: "Three", Artist: "Artist"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+		fake.Track{ID: "three", ISRC: "ISRC3", Name: "Three", Artists: []string{"Artist"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "3", "1")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "one", "three")
+
+	plan := s.sync(Input{})
+	if len(plan.AppleMusicSongs) != 3 {
+		t.Errorf("planned with %d apple music songs, want 3", len(plan.AppleMusicSongs))
+	}
+	if got := s.spotifyPlaylist(); !slices.Equal(got, []string{"one", "three", "one"}) {
+		t.Errorf("spotify playlist = %v, want [one three one]", got)
+	}
+	if plan = s.sync(Input{}); !plan.Empty() {
+		t.Errorf("second sync planned %+v, want nothing", plan)
+	}
+}
+
+// TestPlanConcurrently plans the same playlist from several goroutines like the worker pool does.
+// It is meant to be run with -race.
+func TestPlanConcurrently(t *testing.T) {
+	s := newTestSync(t)
+	s.appleMusic.AddSongs(
+		fake.Song{ID: "1", ISRC: "ISRC1", Name: "Déjà Vu", Artist: "Beyoncé"},
+		fake.Song{ID: "2", ISRC: "ISRC2", Name: "Café", Artist: "Señor"},
+	)
+	s.spotify.AddTracks(
+		fake.Track{ID: "one", ISRC: "ISRC1", Name: "Déjà Vu", Artists: []string{"Beyoncé"}},
+		fake.Track{ID: "two", ISRC: "ISRC2", Name: "Café", Artists: []string{"Señor"}},
+		fake.Track{ID: "other", Name: "Crème Brûlée", Artists: []string{"Zoë"}},
+	)
+	s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "2")
+	s.spotify.SetPlaylist(testSpotifyPlaylist, "two", "other")
+	want := s.plan(Input{})
+
+	input := Input{
+		Playlist:        "test",
+		AppleMusicID:    testAppleMusicPlaylist,
+		SpotifyID:       testSpotifyPlaylist,
+		SnapshotID:      want.SnapshotID,
+		AppleMusicSongs: want.AppleMusicSongs,
+		SpotifySongs:    want.SpotifySongs,
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			plan, err := s.executor.Plan(t.Context(), input)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(plan.Additions) != 1 || len(plan.Removals) != 1 || len(plan.Reorders) != 1 {
+				t.Errorf("planned %+v, want one addition, removal, and move", plan)
+			}
+		})
+	}
+	wg.Wait()
+}
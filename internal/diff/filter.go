@@ -1,43 +1,65 @@
 package diff
 
-import "go.mattglei.ch/musicsync/internal/apis/spotify"
+import "go.mattglei.ch/musicsync/internal/match"
 
-func FilterPlaylists(
-	toAdd []spotify.Song,
-	toDelete []spotify.Song,
-) ([]spotify.Song, []spotify.Song) {
+// FilterPlaylists drops the additions and removals that cancel each other out, which happens when
+// a song is found on Spotify as a different version than the one already in the playlist. An
+// addition and a removal cancel out if they are the same Spotify track or have the same normalized
+// name and artist. Each addition cancels out at most one removal and the other way around, and
+// the same tracks are cancelled out before the same names.
+func FilterPlaylists(additions []Addition, removals []Removal) ([]Addition, []Removal) {
 	var (
-		filteredToAdd    []spotify.Song
-		filteredToDelete []spotify.Song
+		filteredAdditions []Addition
+		filteredRemovals  []Removal
+		byID              = make(map[string][]int, len(removals))
+		cancelled         = make([]bool, len(removals))
+		kept              = make([]bool, len(additions))
 	)
+	for i, removal := range removals {
+		byID[removal.Song.ID] = append(byID[removal.Song.ID], i)
+	}
+	cancel := func(candidates []int) bool {
+		for _, i := range candidates {
+			if !cancelled[i] {
+				cancelled[i] = true
+				return true
+			}
+		}
+		return false
+	}
 
-	for _, songToAdd := range toAdd {
-		contains := false
-		for _, songToRemove := range toDelete {
-			if songToAdd.ID == songToRemove.ID ||
-				(songToAdd.Artist == songToRemove.Artist && songToAdd.Name == songToRemove.Name) {
-				contains = true
-				break
+	remaining := false
+	for i, addition := range additions {
+		kept[i] = !cancel(byID[addition.Match.ID])
+		remaining = remaining || kept[i]
+	}
+	// normalizing is much slower than looking up ids, so only the songs that are left are
+	// normalized
+	if remaining {
+		byName := map[string][]int{}
+		for i, removal := range removals {
+			if !cancelled[i] {
+				key := match.Key(removal.Song.Name, removal.Song.Artist)
+				byName[key] = append(byName[key], i)
 			}
 		}
-		if !contains {
-			filteredToAdd = append(filteredToAdd, songToAdd)
+		for i, addition := range additions {
+			if kept[i] && cancel(byName[match.Key(addition.Match.Name, addition.Match.Artist)]) {
+				kept[i] = false
+			}
 		}
 	}
 
-	for _, songToRemove := range toDelete {
-		contains := false
-		for _, songToAdd := range toAdd {
-			if songToRemove.ID == songToAdd.ID ||
-				(songToRemove.Artist == songToAdd.Artist && songToRemove.Name == songToAdd.Name) {
-				contains = true
-				break
-			}
+	for i, addition := range additions {
+		if kept[i] {
+			filteredAdditions = append(filteredAdditions, addition)
 		}
-		if !contains {
-			filteredToDelete = append(filteredToDelete, songToRemove)
+	}
+	for i, removal := range removals {
+		if !cancelled[i] {
+			filteredRemovals = append(filteredRemovals, removal)
 		}
 	}
 
-	return filteredToAdd, filteredToDelete
+	return filteredAdditions, filteredRemovals
 }
@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+func TestFilterPlaylists(t *testing.T) {
+	additions := []Addition{
+		{Match: spotify.Song{ID: "remaster", Name: "Song - 2011 Remaster", Artist: "Band"}},
+		{Match: spotify.Song{ID: "same", Name: "Same", Artist: "Band"}},
+		{Match: spotify.Song{ID: "new", Name: "New", Artist: "Band"}},
+	}
+	removals := []Removal{
+		{Song: spotify.Song{ID: "original", Name: "Song", Artist: "Band", Position: 0}},
+		{Song: spotify.Song{ID: "same", Name: "Same", Artist: "Band", Position: 1}},
+		{Song: spotify.Song{ID: "other", Name: "Same", Artist: "Band", Position: 2}},
+	}
+	filteredAdditions, filteredRemovals := FilterPlaylists(additions, removals)
+	if len(filteredAdditions) != 1 || filteredAdditions[0].Match.ID != "new" {
+		t.Errorf("additions = %v, want only new", filteredAdditions)
+	}
+	// the addition of same cancels out the removal of the same track instead of the other copy
+	if len(filteredRemovals) != 1 || filteredRemovals[0].Song.ID != "other" {
+		t.Errorf("removals = %v, want only other", filteredRemovals)
+	}
+}
+
+// benchmarkChanges creates n additions and n removals where every other addition cancels out a
+// removal, alternating between the same track and a different track with the same name.
+func benchmarkChanges(n int) ([]Addition, []Removal) {
+	additions := make([]Addition, 0, n)
+	removals := make([]Removal, 0, n)
+	for i := range n {
+		name, artist := fmt.Sprintf("Song %d", i), fmt.Sprintf("Artist %d", i%500)
+		removals = append(removals, Removal{
+			Song: spotify.Song{ID: fmt.Sprint(i), Name: name, Artist: artist, Position: i},
+		})
+
+		j := (i * 7919) % n
+		song := spotify.Song{ID: fmt.Sprintf("new%d", j), Name: fmt.Sprintf("New Song %d", j)}
+		switch j % 4 {
+		case 0:
+			song.ID = fmt.Sprint(j)
+		case 2:
+			song.Name, song.Artist = fmt.Sprintf("Song %d", j), fmt.Sprintf("Artist %d", j%500)
+		}
+		additions = append(additions, Addition{Match: song})
+	}
+	return additions, removals
+}
+
+func BenchmarkFilterPlaylists(b *testing.B) {
+	additions, removals := benchmarkChanges(10_000)
+	b.Run("indexed", func(b *testing.B) {
+		for b.Loop() {
+			FilterPlaylists(additions, removals)
+		}
+	})
+	b.Run("nested loops", func(b *testing.B) {
+		for b.Loop() {
+			nestedFilterPlaylists(additions, removals)
+		}
+	})
+}
+
+// nestedFilterPlaylists is how FilterPlaylists compared every addition with every removal before
+// it used indexes, to compare their performance against.
+func nestedFilterPlaylists(additions []Addition, removals []Removal) ([]Addition, []Removal) {
+	var (
+		filteredAdditions []Addition
+		filteredRemovals  []Removal
+	)
+	same := func(a spotify.Song, b spotify.Song) bool {
+		return a.ID == b.ID || (a.Artist == b.Artist && a.Name == b.Name)
+	}
+	for _, addition := range additions {
+		contains := false
+		for _, removal := range removals {
+			if same(addition.Match, removal.Song) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			filteredAdditions = append(filteredAdditions, addition)
+		}
+	}
+	for _, removal := range removals {
+		contains := false
+		for _, addition := range additions {
+			if same(addition.Match, removal.Song) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			filteredRemovals = append(filteredRemovals, removal)
+		}
+	}
+	return filteredAdditions, filteredRemovals
+}
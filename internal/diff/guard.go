@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyRemovals is returned when applying a plan that removes more songs than the guard
+// allows.
+var ErrTooManyRemovals = errors.New("plan removes too many songs")
+
+// Guard stops plans that remove a large part of a playlist from being applied, which usually means
+// that Apple Music returned an empty or incomplete playlist instead of the songs really being
+// removed. A limit of 0 disables it.
+type Guard struct {
+	// MaxRemovals is the most songs that a plan can remove.
+	MaxRemovals int
+	// MaxRemovalPercent is the most of the Spotify playlist (from 0 to 100) that a plan can
+	// remove.
+	MaxRemovalPercent float64
+}
+
+// Check returns an error wrapping ErrTooManyRemovals if the plan removes more songs than allowed.
+func (g Guard) Check(plan Plan) error {
+	removals := len(plan.Removals)
+	if removals == 0 {
+		return nil
+	}
+	if g.MaxRemovals > 0 && removals > g.MaxRemovals {
+		return fmt.Errorf(
+			"%w (%d songs, the limit is %d)",
+			ErrTooManyRemovals,
+			removals,
+			g.MaxRemovals,
+		)
+	}
+	if g.MaxRemovalPercent > 0 && len(plan.SpotifySongs) != 0 {
+		percent := float64(removals) / float64(len(plan.SpotifySongs)) * 100
+		if percent > g.MaxRemovalPercent {
+			return fmt.Errorf(
+				"%w (%d of %d songs is %.0f%%, the limit is %.0f%%)",
+				ErrTooManyRemovals,
+				removals,
+				len(plan.SpotifySongs),
+				percent,
+				g.MaxRemovalPercent,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+func TestGuardCheck(t *testing.T) {
+	// plan removes removals of the songs in a spotify playlist with songs songs
+	plan := func(removals int, songs int) Plan {
+		p := Plan{SpotifySongs: make([]spotify.Song, songs)}
+		for range removals {
+			p.Removals = append(p.Removals, Removal{Reason: ReasonNotInAppleMusic})
+		}
+		return p
+	}
+	tests := []struct {
+		name    string
+		guard   Guard
+		plan    Plan
+		wantErr bool
+	}{
+		{name: "no removals", guard: Guard{MaxRemovals: 1, MaxRemovalPercent: 1}, plan: plan(0, 10)},
+		{name: "at max removals", guard: Guard{MaxRemovals: 2}, plan: plan(2, 3)},
+		{name: "over max removals", guard: Guard{MaxRemovals: 2}, plan: plan(3, 100), wantErr: true},
+		{name: "at max percent", guard: Guard{MaxRemovalPercent: 50}, plan: plan(5, 10)},
+		{
+			name:    "over max percent",
+			guard:   Guard{MaxRemovalPercent: 50},
+			plan:    plan(6, 10),
+			wantErr: true,
+		},
+		{
+			name:    "under max removals but over max percent",
+			guard:   Guard{MaxRemovals: 50, MaxRemovalPercent: 50},
+			plan:    plan(3, 4),
+			wantErr: true,
+		},
+		{name: "disabled", guard: Guard{}, plan: plan(100, 100)},
+		{
+			name:  "empty spotify playlist",
+			guard: Guard{MaxRemovals: 10, MaxRemovalPercent: 50},
+			plan:  plan(1, 0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.guard.Check(test.plan)
+			if test.wantErr != errors.Is(err, ErrTooManyRemovals) {
+				t.Errorf("Check() = %v, want ErrTooManyRemovals %t", err, test.wantErr)
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("Check() = %v, want nil", err)
+			}
+		})
+	}
+}
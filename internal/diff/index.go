@@ -0,0 +1,143 @@
+package diff
+
+import (
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
+)
+
+// songIndex maps the normalized names and artists (see match.Key) of songs to their positions so
+// that matching songs can be looked up instead of comparing every pair of songs. The normalized
+// names and artists are kept so each song is only normalized once.
+type songIndex struct {
+	byName   map[string][]int
+	byArtist map[string][]int
+	names    []string
+	artists  []string
+}
+
+func newSongIndex(size int) songIndex {
+	return songIndex{
+		byName:   map[string][]int{},
+		byArtist: map[string][]int{},
+		names:    make([]string, size),
+		artists:  make([]string, size),
+	}
+}
+
+func (i songIndex) add(position int, name string, artist string) {
+	name, artist = match.Name(name), match.Artist(artist)
+	key := match.NormalizedKey(name, artist)
+	i.byName[key] = append(i.byName[key], position)
+	i.byArtist[artist] = append(i.byArtist[artist], position)
+	i.names[position] = name
+	i.artists[position] = artist
+}
+
+// matchSongs pairs up Apple Music and Spotify songs one to one so that a song that is in a
+// playlist multiple times needs to be in the other playlist just as many times. Songs are paired
+// by ISRC first, then by normalized name and artist, and finally by the most similar name by the
+// same artist that is above the threshold of the matcher. Empty ISRCs are never compared so two
+// songs without an ISRC aren't considered the same song. Earlier copies of a song are paired
+// first. The index of the Apple Music song paired with each Spotify song is returned, or -1 if it
+// wasn't paired.
+//
+// Pinned is the Spotify ID that each Apple Music song is pinned to by the overrides, or empty if
+// it isn't pinned (see pinnedIDs). Pinned songs are only ever paired with their Spotify track.
+// Pinned can be nil if no songs are pinned.
+func matchSongs(
+	appleMusicSongs []applemusic.Song,
+	spotifySongs []spotify.Song,
+	matcher match.Matcher,
+	pinned []string,
+) []int {
+	var (
+		byISRC   = make(map[string][]int, len(appleMusicSongs))
+		byPinned = map[string][]int{}
+		used     = make([]bool, len(appleMusicSongs))
+		matches  = make([]int, len(spotifySongs))
+	)
+	for i, song := range appleMusicSongs {
+		if i < len(pinned) && pinned[i] != "" {
+			byPinned[pinned[i]] = append(byPinned[pinned[i]], i)
+			continue
+		}
+		if song.ISRC != "" {
+			byISRC[song.ISRC] = append(byISRC[song.ISRC], i)
+		}
+	}
+	take := func(candidates []int) int {
+		for _, i := range candidates {
+			if !used[i] {
+				used[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	unmatched := false
+	for i, song := range spotifySongs {
+		matches[i] = take(byPinned[song.ID])
+		if matches[i] == -1 {
+			matches[i] = take(byISRC[song.ISRC])
+		}
+		unmatched = unmatched || matches[i] == -1
+	}
+	// pinned songs that aren't in the spotify playlist are left to be added as their track
+	for _, positions := range byPinned {
+		for _, i := range positions {
+			used[i] = true
+		}
+	}
+	if !unmatched {
+		return matches
+	}
+
+	// normalizing is much slower than looking up isrcs, so only the songs that weren't paired by
+	// isrc are normalized
+	var (
+		appleMusicIndex = newSongIndex(len(appleMusicSongs))
+		spotifyIndex    = newSongIndex(len(spotifySongs))
+	)
+	for i, song := range appleMusicSongs {
+		if !used[i] {
+			appleMusicIndex.add(i, song.Name, song.Artist)
+		}
+	}
+	for i, song := range spotifySongs {
+		if matches[i] != -1 {
+			continue
+		}
+		spotifyIndex.add(i, song.Name, song.Artist)
+		key := match.NormalizedKey(spotifyIndex.names[i], spotifyIndex.artists[i])
+		matches[i] = take(appleMusicIndex.byName[key])
+	}
+
+	// only songs by the same artist are compared so this doesn't compare every leftover pair
+	for i := range spotifySongs {
+		if matches[i] != -1 {
+			continue
+		}
+		best, bestScore := -1, 0.0
+		for _, candidate := range appleMusicIndex.byArtist[spotifyIndex.artists[i]] {
+			if used[candidate] {
+				continue
+			}
+			score, ok := matcher.ScoreNormalized(
+				spotifyIndex.names[i],
+				spotifyIndex.artists[i],
+				appleMusicIndex.names[candidate],
+				appleMusicIndex.artists[candidate],
+			)
+			if ok && score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+		if best != -1 {
+			used[best] = true
+			matches[i] = best
+		}
+	}
+	return matches
+}
@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/overrides"
+)
+
+// pinnedIDs returns the Spotify ID that each song is pinned to by the overrides, or an empty
+// string for songs that aren't pinned. Nil is returned if no songs are pinned.
+func pinnedIDs(songs []applemusic.Song, overrides overrides.Overrides) []string {
+	if len(overrides.Pins) == 0 {
+		return nil
+	}
+	ids := make([]string, len(songs))
+	for i, song := range songs {
+		ids[i], _ = overrides.Pinned(song)
+	}
+	return ids
+}
+
+// resolveSongs finds the Spotify songs for the Apple Music songs. Songs pinned by the overrides
+// use the Spotify track they are pinned to and every other song is searched for (see findSongs).
+func (e Executor) resolveSongs(
+	ctx context.Context,
+	songs []applemusic.Song,
+	overrides overrides.Overrides,
+) ([]spotify.Match, error) {
+	var (
+		matches   = make([]spotify.Match, len(songs))
+		toFind    []applemusic.Song
+		positions []int
+	)
+	for i, song := range songs {
+		id, ok := overrides.Pinned(song)
+		if !ok {
+			toFind = append(toFind, song)
+			positions = append(positions, i)
+			continue
+		}
+		pinned, err := spotify.SongByID(ctx, e.Spotify, id)
+		if err != nil {
+			return []spotify.Match{}, fmt.Errorf(
+				"%w failed to get spotify song that \"%s\" by \"%s\" is pinned to",
+				err,
+				song.Name,
+				song.Artist,
+			)
+		}
+		matches[i] = spotify.Match{
+			Source:     song,
+			Song:       pinned,
+			Found:      true,
+			Reason:     "pinned by an override",
+			Confidence: 1,
+		}
+	}
+	if len(toFind) == 0 {
+		return matches, nil
+	}
+
+	found, err := e.findSongs(ctx, toFind)
+	if err != nil {
+		return []spotify.Match{}, err
+	}
+	for i, match := range found {
+		matches[positions[i]] = match
+	}
+	return matches, nil
+}
@@ -0,0 +1,55 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/fake"
+	"go.mattglei.ch/musicsync/internal/overrides"
+)
+
+func TestSyncPinnedSongs(t *testing.T) {
+	tests := []struct {
+		name    string
+		spotify []string
+		want    []string
+	}{
+		{
+			name:    "replaces the song with the same isrc",
+			spotify: []string{"one", "two"},
+			want:    []string{"live", "two"},
+		},
+		{name: "adds the pinned track", spotify: []string{"two"}, want: []string{"live", "two"}},
+		{name: "keeps the pinned track", spotify: []string{"live", "two"}, want: []string{"live", "two"}},
+		{
+			name:    "keeps one copy of the pinned track",
+			spotify: []string{"two", "live", "one", "live"},
+			want:    []string{"live", "two"},
+		},
+	}
+	pins := overrides.Overrides{Pins: []overrides.Pin{{ISRC: "ISRC1", SpotifyID: "live"}}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestSync(t)
+			s.appleMusic.AddSongs(
+				fake.Song{ID: "1", ISRC: "ISRC1", Name: "One", Artist: "Artist"},
+				fake.Song{ID: "2", ISRC: "ISRC2", Name: "Two", Artist: "Artist"},
+			)
+			s.spotify.AddTracks(
+				fake.Track{ID: "one", ISRC: "ISRC1", Name: "One", Artists: []string{"Artist"}},
+				fake.Track{ID: "live", ISRC: "ISRC1", Name: "One - Live", Artists: []string{"Artist"}},
+				fake.Track{ID: "two", ISRC: "ISRC2", Name: "Two", Artists: []string{"Artist"}},
+			)
+			s.appleMusic.SetPlaylist(testAppleMusicPlaylist, "1", "2")
+			s.spotify.SetPlaylist(testSpotifyPlaylist, test.spotify...)
+
+			s.sync(Input{Overrides: pins})
+			if got := s.spotifyPlaylist(); !slices.Equal(got, test.want) {
+				t.Errorf("spotify playlist = %v, want %v", got, test.want)
+			}
+			if plan := s.sync(Input{Overrides: pins}); !plan.Empty() {
+				t.Errorf("second sync planned %+v, want nothing", plan)
+			}
+		})
+	}
+}
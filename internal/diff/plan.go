@@ -0,0 +1,347 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
+	"go.mattglei.ch/musicsync/internal/overrides"
+	"go.mattglei.ch/musicsync/internal/store"
+	"go.mattglei.ch/timber"
+)
+
+// Reason explains why a change is part of a plan.
+type Reason string
+
+const (
+	ReasonNotInSpotify          Reason = "in apple music but not in spotify"
+	ReasonNotInAppleMusic       Reason = "in spotify but not in apple music"
+	ReasonAddedToAppleMusic     Reason = "added to apple music since the last sync"
+	ReasonAddedToSpotify        Reason = "added to spotify since the last sync"
+	ReasonRemovedFromAppleMusic Reason = "removed from apple music since the last sync"
+	ReasonRestoredToSpotify     Reason = "restored to spotify by the conflict policy"
+	ReasonRestoredToAppleMusic  Reason = "restored to apple music by the conflict policy"
+	ReasonOutOfOrder            Reason = "out of order compared to apple music"
+	ReasonPlaylistChanged       Reason = "playlist was changed"
+	ReasonExcluded              Reason = "excluded by an override"
+)
+
+// Plan is every change that syncing a playlist will make. Plans are created by Executor.Plan,
+// contain everything needed to apply them with Executor.Apply, and can be serialized to JSON.
+type Plan struct {
+	Playlist     string `json:"playlist"`
+	AppleMusicID string `json:"apple_music"`
+	SpotifyID    string `json:"spotify"`
+	SnapshotID   string `json:"snapshot_id"`
+
+	Additions           []Addition           `json:"additions"`
+	Removals            []Removal            `json:"removals"`
+	Unmatched           []Unmatched          `json:"unmatched"`
+	AppleMusicAdditions []AppleMusicAddition `json:"apple_music_additions"`
+	Reorders            []Move               `json:"reorders"`
+	Metadata            []MetadataUpdate     `json:"metadata"`
+	Skipped             []Skipped            `json:"skipped"`
+
+	// AppleMusicSongs and SpotifySongs are the playlists as they were when the plan was made.
+	AppleMusicSongs []applemusic.Song `json:"-"`
+	SpotifySongs    []spotify.Song    `json:"-"`
+
+	// known are the keys of the songs that the plan leaves alone that should still be known at the
+	// next sync: songs that are in both playlists and songs that the conflict policy keeps out of
+	// one of them.
+	known []string
+}
+
+// Addition is an Apple Music song that will be added to the Spotify playlist as Match.
+type Addition struct {
+	Source     applemusic.Song `json:"source"`
+	Match      spotify.Song    `json:"match"`
+	MatchedBy  string          `json:"matched_by"`
+	Confidence float64         `json:"confidence"`
+	Reason     Reason          `json:"reason"`
+}
+
+// Removal is a song that will be removed from the Spotify playlist.
+type Removal struct {
+	Song   spotify.Song `json:"song"`
+	Reason Reason       `json:"reason"`
+}
+
+// Unmatched is an Apple Music song that should be added to Spotify but couldn't be found there.
+type Unmatched struct {
+	Song   applemusic.Song `json:"song"`
+	Reason Reason          `json:"reason"`
+}
+
+// AppleMusicAddition is a Spotify song that will be added to the Apple Music playlist as Match.
+type AppleMusicAddition struct {
+	Source spotify.Song    `json:"source"`
+	Match  applemusic.Song `json:"match"`
+	Reason Reason          `json:"reason"`
+}
+
+// MetadataUpdate is a change to a field of the Spotify playlist itself.
+type MetadataUpdate struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason Reason `json:"reason"`
+}
+
+// Skipped is a song that would have been added to or removed from a playlist but was left alone.
+type Skipped struct {
+	Name   string `json:"name"`
+	Artist string `json:"artist"`
+	ISRC   string `json:"isrc"`
+	Reason Reason `json:"reason"`
+}
+
+// Empty reports if the plan doesn't change anything.
+func (p Plan) Empty() bool {
+	return len(p.Additions) == 0 && len(p.Removals) == 0 && len(p.AppleMusicAdditions) == 0 &&
+		len(p.Reorders) == 0 && len(p.Metadata) == 0
+}
+
+// Input is everything needed to plan the sync of a playlist.
+type Input struct {
+	Playlist        string
+	AppleMusicID    string
+	SpotifyID       string
+	SnapshotID      string
+	AppleMusicSongs []applemusic.Song
+	SpotifySongs    []spotify.Song
+	// Description is set as the description of the Spotify playlist if anything changes.
+	// Leave it empty to never change the description.
+	Description string
+
+	Bidirectional  bool
+	ConflictPolicy ConflictPolicy
+	// Previous are the keys of the songs that were known at the last sync (see StateKeys). It is
+	// nil if the playlist has never been synced bidirectionally, which makes the sync one-way.
+	Previous []string
+
+	// Overrides pin songs to Spotify tracks and exclude songs from being synced.
+	Overrides overrides.Overrides
+}
+
+// Executor plans and applies syncs using the Spotify and Apple Music APIs.
+type Executor struct {
+	AppleMusic *applemusic.Client
+	Spotify    *spotify.Client
+	Matcher    match.Matcher
+	// Cache is where the results of searching Spotify for songs are cached. Nil disables caching.
+	Cache *store.MatchCache
+	// Guard refuses to apply plans that remove too many songs.
+	Guard Guard
+	// Snapshots is where the Spotify playlist is recorded before it is changed so that it can be
+	// rolled back. Nil disables snapshots.
+	Snapshots *store.File[store.Snapshots]
+	// Audit is where every song that is added or removed is recorded. Nil disables the audit log.
+	Audit *store.AuditLog
+}
+
+// Plan works out what needs to change to sync a playlist. It searches Spotify (and Apple Music for
+// bidirectional playlists) for the songs that need to be added but doesn't change anything.
+func (e Executor) Plan(ctx context.Context, input Input) (Plan, error) {
+	prefix := logPrefix(input.Playlist)
+	plan := Plan{
+		Playlist:        input.Playlist,
+		AppleMusicID:    input.AppleMusicID,
+		SpotifyID:       input.SpotifyID,
+		SnapshotID:      input.SnapshotID,
+		AppleMusicSongs: input.AppleMusicSongs,
+		SpotifySongs:    input.SpotifySongs,
+	}
+
+	// without the songs from the last sync, songs that are only in spotify can't be told apart from
+	// songs that were removed from apple music. the first sync is one-way so those songs aren't
+	// added to apple music, where they couldn't be removed again
+	bidirectional := input.Bidirectional && input.Previous != nil
+	if input.Bidirectional && !bidirectional {
+		timber.Info(prefix, "Syncing one-way from APPLE MUSIC as this is the first bidirectional sync")
+	}
+	known := map[string]bool{}
+	for _, key := range input.Previous {
+		known[key] = true
+	}
+
+	var (
+		pinned          = pinnedIDs(input.AppleMusicSongs, input.Overrides)
+		matches         = matchSongs(input.AppleMusicSongs, input.SpotifySongs, e.Matcher, pinned)
+		toAdd, toDelete = splitMatches(input.AppleMusicSongs, input.SpotifySongs, matches)
+		toFind          []applemusic.Song
+		addReasons      []Reason
+		toAppleMusic    []spotify.Song
+		mirrorReasons   []Reason
+	)
+	for i, match := range matches {
+		if match != -1 {
+			appleMusicSong, spotifySong := input.AppleMusicSongs[match], input.SpotifySongs[i]
+			plan.known = append(
+				plan.known,
+				SongKey(appleMusicSong.ISRC, appleMusicSong.Name, appleMusicSong.Artist),
+				SongKey(spotifySong.ISRC, spotifySong.Name, spotifySong.Artist),
+			)
+		}
+	}
+	for _, song := range toAdd {
+		if input.Overrides.Excluded(song.ISRC, song.ID, input.Playlist, input.AppleMusicID) {
+			plan.Skipped = append(plan.Skipped, Skipped{
+				Name:   song.Name,
+				Artist: song.Artist,
+				ISRC:   song.ISRC,
+				Reason: ReasonExcluded,
+			})
+			continue
+		}
+		reason := ReasonNotInSpotify
+		if bidirectional {
+			reason = ReasonAddedToAppleMusic
+			if key := SongKey(song.ISRC, song.Name, song.Artist); known[key] {
+				if input.ConflictPolicy == SpotifyWins {
+					plan.known = append(plan.known, key)
+					continue
+				}
+				reason = ReasonRestoredToSpotify
+			}
+		}
+		toFind = append(toFind, song)
+		addReasons = append(addReasons, reason)
+	}
+	for _, song := range toDelete {
+		// excluded songs are left alone on both sides instead of being removed or mirrored
+		if input.Overrides.Excluded(song.ISRC, "", input.Playlist, input.AppleMusicID) {
+			plan.Skipped = append(plan.Skipped, Skipped{
+				Name:   song.Name,
+				Artist: song.Artist,
+				ISRC:   song.ISRC,
+				Reason: ReasonExcluded,
+			})
+			continue
+		}
+		if !bidirectional {
+			plan.Removals = append(plan.Removals, Removal{Song: song, Reason: ReasonNotInAppleMusic})
+			continue
+		}
+		switch {
+		case !known[SongKey(song.ISRC, song.Name, song.Artist)]:
+			toAppleMusic = append(toAppleMusic, song)
+			mirrorReasons = append(mirrorReasons, ReasonAddedToSpotify)
+		case input.ConflictPolicy == "" || input.ConflictPolicy == AppleMusicWins:
+			plan.Removals = append(
+				plan.Removals,
+				Removal{Song: song, Reason: ReasonRemovedFromAppleMusic},
+			)
+		default:
+			toAppleMusic = append(toAppleMusic, song)
+			mirrorReasons = append(mirrorReasons, ReasonRestoredToAppleMusic)
+		}
+	}
+
+	timber.Done(prefix, "[5/10]", "Found playlist diff")
+
+	if len(toFind) != 0 {
+		matches, err := e.resolveSongs(ctx, toFind, input.Overrides)
+		if err != nil {
+			return plan, fmt.Errorf("%w failed to find isrcs in spotify", err)
+		}
+		for i, match := range matches {
+			if !match.Found {
+				plan.Unmatched = append(
+					plan.Unmatched,
+					Unmatched{Song: match.Source, Reason: Reason(match.Reason)},
+				)
+				continue
+			}
+			matchedBy := match.Reason
+			if match.Cached {
+				matchedBy += " (cached)"
+			}
+			plan.Additions = append(plan.Additions, Addition{
+				Source:     match.Source,
+				Match:      match.Song,
+				MatchedBy:  matchedBy,
+				Confidence: match.Confidence,
+				Reason:     addReasons[i],
+			})
+		}
+		timber.Done(prefix, "[6/10]", "Found", len(plan.Additions), "in spotify from Apple Music")
+	} else {
+		timber.Info(prefix, "[6/10]", "Skipped as there are no songs in initial to add list")
+	}
+	plan.Additions, plan.Removals = FilterPlaylists(plan.Additions, plan.Removals)
+
+	for i, song := range toAppleMusic {
+		if song.ISRC == "" {
+			timber.Warning(prefix,
+				fmt.Sprintf("\"%s\" by \"%s\"", song.Name, song.Artist),
+				"has no isrc to find it in APPLE MUSIC with",
+			)
+			continue
+		}
+		results, err := applemusic.SearchISRC(ctx, e.AppleMusic, song.ISRC)
+		if err != nil {
+			return plan, fmt.Errorf("%w failed to find spotify song in apple music", err)
+		}
+		if len(results) == 0 {
+			timber.Warning(prefix,
+				fmt.Sprintf("\"%s\" by \"%s\"", song.Name, song.Artist),
+				"couldn't be found in APPLE MUSIC",
+			)
+			continue
+		}
+		plan.AppleMusicAdditions = append(plan.AppleMusicAdditions, AppleMusicAddition{
+			Source: song,
+			Match:  results[0],
+			Reason: mirrorReasons[i],
+		})
+	}
+
+	// removing songs takes them out at their positions and adding songs appends them to the end
+	// so the playlist can be reordered as it will be after those edits
+	removed := plan.removedPositions()
+	edited := []spotify.Song{}
+	for _, song := range input.SpotifySongs {
+		if !removed[song.Position] {
+			song.Position = len(edited)
+			edited = append(edited, song)
+		}
+	}
+	for _, addition := range plan.Additions {
+		song := addition.Match
+		song.Position = len(edited)
+		edited = append(edited, song)
+	}
+	// local files aren't in the list of songs, so moves would be off by them
+	if n := len(input.SpotifySongs); n != 0 && input.SpotifySongs[n-1].Position != n-1 {
+		timber.Warning(prefix, "Not reordering as the SPOTIFY playlist has local or unavailable songs")
+	} else {
+		plan.Reorders = Reorder(input.AppleMusicSongs, edited, e.Matcher, pinned)
+	}
+
+	changed := len(plan.Additions) != 0 || len(plan.Removals) != 0 || len(plan.Reorders) != 0
+	if changed && input.Description != "" {
+		plan.Metadata = append(plan.Metadata, MetadataUpdate{
+			Field:  "description",
+			Value:  input.Description,
+			Reason: ReasonPlaylistChanged,
+		})
+	}
+
+	return plan, nil
+}
+
+// logPrefix is put in front of every log line about a playlist so the logs of playlists that are
+// synced at the same time can be told apart.
+func logPrefix(playlist string) string {
+	return "[" + playlist + "]"
+}
+
+func (p Plan) removedPositions() map[int]bool {
+	removed := make(map[int]bool, len(p.Removals))
+	for _, removal := range p.Removals {
+		removed[removal.Song.Position] = true
+	}
+	return removed
+}
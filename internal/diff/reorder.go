@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
+)
+
+// Move is a single Spotify "reorder items" operation that moves the RangeLength songs starting at
+// RangeStart so that they are placed before the song currently at InsertBefore. Moves are meant to
+// be applied in order, each one against the playlist as it is after the previous moves.
+type Move struct {
+	Songs        []spotify.Song `json:"songs"`
+	RangeStart   int            `json:"range_start"`
+	RangeLength  int            `json:"range_length"`
+	InsertBefore int            `json:"insert_before"`
+	Reason       Reason         `json:"reason"`
+}
+
+// Summary describes the songs that are moved, like "Name" by "Artist" and 2 more songs.
+func (m Move) Summary() string {
+	if len(m.Songs) == 0 {
+		return "no songs"
+	}
+	summary := fmt.Sprintf("\"%s\" by \"%s\"", m.Songs[0].Name, m.Songs[0].Artist)
+	switch len(m.Songs) {
+	case 1:
+		return summary
+	case 2:
+		return summary + " and 1 more song"
+	default:
+		return fmt.Sprintf("%s and %d more songs", summary, len(m.Songs)-1)
+	}
+}
+
+// Reorder computes the moves needed to put the Spotify playlist in the same order as the Apple
+// Music playlist. Songs that stay in the same relative order (the longest increasing subsequence)
+// are never moved so the number of moves is as small as possible, and songs that are next to each
+// other both before and after being moved are moved together. Spotify songs that aren't in the
+// Apple Music playlist are kept in their current relative order after all the other songs.
+// Pinned is the Spotify ID each Apple Music song is pinned to, like for matchSongs.
+func Reorder(
+	appleMusicSongs []applemusic.Song,
+	spotifySongs []spotify.Song,
+	matcher match.Matcher,
+	pinned []string,
+) []Move {
+	ranks := spotifyRanks(appleMusicSongs, spotifySongs, matcher, pinned)
+
+	// target is the indexes of spotifySongs in the order they should end up in
+	target := make([]int, len(spotifySongs))
+	for i := range target {
+		target[i] = i
+	}
+	sort.SliceStable(target, func(i, j int) bool { return ranks[target[i]] < ranks[target[j]] })
+	staying := longestIncreasingSubsequence(ranks)
+
+	// every song that is moved is placed right after the song before it in the target order, so
+	// where each song ends up is known before anything is moved. songs are ordered by their
+	// current key, which starts as their position and is replaced by their final key once moved
+	var (
+		n         = len(spotifySongs)
+		finalKeys = make([]int, n)
+		anchor    = -1
+		offset    = 0
+	)
+	for _, song := range target {
+		if staying[song] {
+			anchor, offset = song, 0
+			continue
+		}
+		offset++
+		finalKeys[song] = (anchor+1)*(n+1) + offset
+	}
+	keys := make([]int, 0, 2*n)
+	for song := range n {
+		keys = append(keys, (song+1)*(n+1))
+		if !staying[song] {
+			keys = append(keys, finalKeys[song])
+		}
+	}
+	slices.Sort(keys)
+	slot := func(key int) int {
+		i, _ := slices.BinarySearch(keys, key)
+		return i
+	}
+	playlist := newFenwickTree(len(keys))
+	for song := range n {
+		playlist.add(slot((song+1)*(n+1)), 1)
+	}
+	position := func(key int) int { return playlist.sum(slot(key)) }
+
+	var moves []Move
+	for t := 0; t < n; {
+		song := target[t]
+		if staying[song] {
+			t++
+			continue
+		}
+
+		// songs that are next to each other in both orders stay together and move as one range
+		length := 1
+		for t+length < n && target[t+length] == song+length && !staying[song+length] {
+			length++
+		}
+
+		from := position((song + 1) * (n + 1))
+		insertBefore := 0
+		if t != 0 {
+			previous := target[t-1]
+			previousKey := (previous + 1) * (n + 1)
+			if !staying[previous] {
+				previousKey = finalKeys[previous]
+			}
+			insertBefore = position(previousKey) + 1
+		}
+		for i := range length {
+			playlist.add(slot((song+i+1)*(n+1)), -1)
+			playlist.add(slot(finalKeys[song+i]), 1)
+		}
+
+		if insertBefore != from {
+			moves = append(moves, Move{
+				Songs:        spotifySongs[song : song+length],
+				RangeStart:   from,
+				RangeLength:  length,
+				InsertBefore: insertBefore,
+				Reason:       ReasonOutOfOrder,
+			})
+		}
+		t += length
+	}
+
+	return moves
+}
+
+// spotifyRanks gives each Spotify song the position of the Apple Music song it matches (see
+// matchSongs). Songs without a match are ranked after every Apple Music song in their current
+// order.
+func spotifyRanks(
+	appleMusicSongs []applemusic.Song,
+	spotifySongs []spotify.Song,
+	matcher match.Matcher,
+	pinned []string,
+) []int {
+	ranks := matchSongs(appleMusicSongs, spotifySongs, matcher, pinned)
+	for i, rank := range ranks {
+		if rank == -1 {
+			ranks[i] = len(appleMusicSongs) + i
+		}
+	}
+	return ranks
+}
+
+// longestIncreasingSubsequence returns the set of indexes of values that make up one of the
+// longest strictly increasing subsequences.
+func longestIncreasingSubsequence(values []int) map[int]bool {
+	var (
+		// tails[k] is the index of the smallest value that ends an increasing subsequence of
+		// length k+1
+		tails    []int
+		previous = make([]int, len(values))
+	)
+	for i, value := range values {
+		k := sort.Search(len(tails), func(k int) bool { return values[tails[k]] >= value })
+		if k > 0 {
+			previous[i] = tails[k-1]
+		} else {
+			previous[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	sequence := map[int]bool{}
+	if len(tails) == 0 {
+		return sequence
+	}
+	for i := tails[len(tails)-1]; i != -1; i = previous[i] {
+		sequence[i] = true
+	}
+	return sequence
+}
+
+// fenwickTree counts how many songs are before a position in the playlist in logarithmic time
+// while songs are being moved.
+type fenwickTree []int
+
+func newFenwickTree(size int) fenwickTree {
+	return make(fenwickTree, size+1)
+}
+
+func (f fenwickTree) add(i int, delta int) {
+	for i++; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// sum is the total of everything before i.
+func (f fenwickTree) sum(i int) int {
+	total := 0
+	for ; i > 0; i -= i & -i {
+		total += f[i]
+	}
+	return total
+}
@@ -0,0 +1,159 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+	"go.mattglei.ch/musicsync/internal/match"
+)
+
+// applyMoves moves the songs like Spotify's "reorder items" endpoint.
+func applyMoves(t *testing.T, songs []spotify.Song, moves []Move) []spotify.Song {
+	t.Helper()
+	songs = slices.Clone(songs)
+	for _, move := range moves {
+		end := move.RangeStart + move.RangeLength
+		moved := slices.Clone(songs[move.RangeStart:end])
+		if !slices.EqualFunc(moved, move.Songs, func(a, b spotify.Song) bool { return a.ID == b.ID }) {
+			t.Fatalf("move %+v would move %v", move, moved)
+		}
+		insertBefore := move.InsertBefore
+		if insertBefore > move.RangeStart {
+			insertBefore -= move.RangeLength
+		}
+		songs = slices.Insert(slices.Delete(songs, move.RangeStart, end), insertBefore, moved...)
+	}
+	return songs
+}
+
+// testPlaylists creates an Apple Music and a Spotify playlist with songs identified by the ISRCs.
+func testPlaylists(appleMusic []string, spotifyISRCs []string) ([]applemusic.Song, []spotify.Song) {
+	appleMusicSongs := make([]applemusic.Song, len(appleMusic))
+	for i, isrc := range appleMusic {
+		appleMusicSongs[i] = applemusic.Song{ISRC: isrc, Name: "Song " + isrc, Artist: "Artist"}
+	}
+	spotifySongs := make([]spotify.Song, len(spotifyISRCs))
+	for i, isrc := range spotifyISRCs {
+		spotifySongs[i] = spotify.Song{
+			ID:       fmt.Sprint(i),
+			ISRC:     isrc,
+			Name:     "Song " + isrc,
+			Artist:   "Artist",
+			Position: i,
+		}
+	}
+	return appleMusicSongs, spotifySongs
+}
+
+func isrcs(songs []spotify.Song) []string {
+	values := make([]string, len(songs))
+	for i, song := range songs {
+		values[i] = song.ISRC
+	}
+	return values
+}
+
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		appleMusic []string
+		spotify    []string
+		want       []string
+		moves      int
+	}{
+		{
+			name:       "already in order",
+			appleMusic: []string{"A", "B", "C", "D"},
+			spotify:    []string{"A", "B", "C", "D"},
+			want:       []string{"A", "B", "C", "D"},
+			moves:      0,
+		},
+		{
+			name:       "empty",
+			appleMusic: []string{},
+			spotify:    []string{},
+			want:       []string{},
+			moves:      0,
+		},
+		{
+			name:       "one song out of place",
+			appleMusic: []string{"A", "B", "C", "D"},
+			spotify:    []string{"B", "C", "D", "A"},
+			want:       []string{"A", "B", "C", "D"},
+			moves:      1,
+		},
+		{
+			name:       "adjacent songs move together",
+			appleMusic: []string{"A", "B", "C", "D", "E"},
+			spotify:    []string{"C", "D", "E", "A", "B"},
+			want:       []string{"A", "B", "C", "D", "E"},
+			moves:      1,
+		},
+		{
+			name:       "reversed",
+			appleMusic: []string{"A", "B", "C", "D"},
+			spotify:    []string{"D", "C", "B", "A"},
+			want:       []string{"A", "B", "C", "D"},
+			moves:      3,
+		},
+		{
+			name:       "duplicates",
+			appleMusic: []string{"A", "B", "A", "C"},
+			spotify:    []string{"A", "A", "C", "B"},
+			want:       []string{"A", "B", "A", "C"},
+			moves:      1,
+		},
+		{
+			name:       "songs not in apple music stay at the end",
+			appleMusic: []string{"A", "B", "C"},
+			spotify:    []string{"X", "C", "Y", "A", "B"},
+			want:       []string{"A", "B", "C", "X", "Y"},
+			moves:      3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appleMusicSongs, spotifySongs := testPlaylists(test.appleMusic, test.spotify)
+			moves := Reorder(appleMusicSongs, spotifySongs, match.Matcher{}, nil)
+			got := isrcs(applyMoves(t, spotifySongs, moves))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("reordered playlist = %v, want %v", got, test.want)
+			}
+			if len(moves) != test.moves {
+				t.Errorf("got %d moves, want %d: %+v", len(moves), test.moves, moves)
+			}
+		})
+	}
+}
+
+func TestReorderShuffled(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	for range 200 {
+		n := random.IntN(60)
+		appleMusic := make([]string, n)
+		for i := range appleMusic {
+			// few enough different songs that most playlists have duplicates
+			appleMusic[i] = fmt.Sprint(random.IntN(n/2 + 1))
+		}
+		spotifyISRCs := slices.Clone(appleMusic)
+		random.Shuffle(len(spotifyISRCs), func(i, j int) {
+			spotifyISRCs[i], spotifyISRCs[j] = spotifyISRCs[j], spotifyISRCs[i]
+		})
+
+		appleMusicSongs, spotifySongs := testPlaylists(appleMusic, spotifyISRCs)
+		moves := Reorder(appleMusicSongs, spotifySongs, match.Matcher{}, nil)
+		got := isrcs(applyMoves(t, spotifySongs, moves))
+		if !slices.Equal(got, appleMusic) {
+			t.Fatalf("reordered %v to %v, want %v", spotifyISRCs, got, appleMusic)
+		}
+
+		ranks := spotifyRanks(appleMusicSongs, spotifySongs, match.Matcher{}, nil)
+		if moved := len(spotifySongs) - len(longestIncreasingSubsequence(ranks)); len(moves) > moved {
+			t.Fatalf("got %d moves for %d songs out of order", len(moves), moved)
+		}
+	}
+}
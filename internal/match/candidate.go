@@ -0,0 +1,153 @@
+package match
+
+import (
+	"regexp"
+	"slices"
+	"time"
+)
+
+// DefaultConfidence is the confidence that a search result needs to be accepted as a match when
+// no minimum confidence is configured.
+const DefaultConfidence = 0.75
+
+// Candidate is a song from either service described by the metadata that matches are scored on.
+type Candidate struct {
+	ISRC     string
+	Name     string
+	Artist   string
+	Album    string
+	Duration time.Duration
+	Explicit bool
+}
+
+// how much each piece of metadata counts towards the confidence of a match
+const (
+	nameWeight     = 0.35
+	artistWeight   = 0.3
+	durationWeight = 0.2
+	albumWeight    = 0.1
+	explicitWeight = 0.05
+)
+
+// versionPenalty multiplies the confidence of a candidate that is a different version of a song
+// than the source, like a live recording or a remaster of the original.
+const versionPenalty = 0.6
+
+// words in a song name that mark it as a different version of a song. Name removes remaster notes
+// so the same song is still matched in playlists, but a search for the original shouldn't pick one
+var versionRegex = regexp.MustCompile(
+	`\b(karaoke|live|remaster|remastered|instrumental|acoustic|remix|remixed|demo|cover|tribute)\b`,
+)
+
+// Confidence scores how likely it is that the candidate is the same recording as the source from
+// 0 to 1. Songs with the same ISRC are always the same recording. Otherwise the score is a
+// weighted average of how similar the names, artists, durations, albums, and explicitness are.
+// Durations and albums are left out of the average when either song doesn't have one. Candidates
+// whose names mark them as a different version (see versionRegex) than the source are penalized.
+func (m Matcher) Confidence(source Candidate, candidate Candidate) float64 {
+	if source.ISRC != "" && source.ISRC == candidate.ISRC {
+		return 1
+	}
+
+	var total, weights float64
+	add := func(weight float64, score float64) {
+		total += weight * score
+		weights += weight
+	}
+	add(nameWeight, Similarity(Name(source.Name), Name(candidate.Name)))
+	add(artistWeight, artistOverlap(source.Artist, candidate.Artist))
+	if source.Duration != 0 && candidate.Duration != 0 {
+		add(durationWeight, durationSimilarity(source.Duration, candidate.Duration))
+	}
+	if source.Album != "" && candidate.Album != "" {
+		add(albumWeight, Similarity(Name(source.Album), Name(candidate.Album)))
+	}
+	explicit := 0.0
+	if source.Explicit == candidate.Explicit {
+		explicit = 1
+	}
+	add(explicitWeight, explicit)
+	confidence := total / weights
+	if !slices.Equal(versions(source.Name), versions(candidate.Name)) {
+		confidence *= versionPenalty
+	}
+	return confidence
+}
+
+// versions returns the words in a song name that mark it as a different version of the song, in
+// order and without duplicates.
+func versions(name string) []string {
+	words := versionRegex.FindAllString(fold(name), -1)
+	for i, word := range words {
+		switch word {
+		case "remastered":
+			words[i] = "remaster"
+		case "remixed":
+			words[i] = "remix"
+		}
+	}
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// Best returns the index of the candidate with the highest confidence, that confidence, and if it
+// is at or above the minimum confidence of the matcher. The index is -1 if there are no
+// candidates.
+func (m Matcher) Best(source Candidate, candidates []Candidate) (int, float64, bool) {
+	minConfidence := m.MinConfidence
+	if minConfidence == 0 {
+		minConfidence = DefaultConfidence
+	}
+	best, bestConfidence := -1, 0.0
+	for i, candidate := range candidates {
+		confidence := m.Confidence(source, candidate)
+		if best == -1 || confidence > bestConfidence {
+			best, bestConfidence = i, confidence
+		}
+	}
+	return best, bestConfidence, best != -1 && bestConfidence >= minConfidence
+}
+
+// artistOverlap is the share of the artists of both songs that are artists of both of them. Artist
+// names that are the same once normalized always overlap completely, even if they would be split
+// into several artists like "Earth, Wind & Fire".
+func artistOverlap(a string, b string) float64 {
+	if Artist(a) != "" && clean(fold(a)) == clean(fold(b)) {
+		return 1
+	}
+	artistsA, artistsB := unique(Artists(a)), unique(Artists(b))
+	if len(artistsA) == 0 || len(artistsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for _, artist := range artistsB {
+		if slices.Contains(artistsA, artist) {
+			shared++
+		}
+	}
+	return float64(shared) / float64(max(len(artistsA), len(artistsB)))
+}
+
+func unique(artists []string) []string {
+	slices.Sort(artists)
+	return slices.Compact(artists)
+}
+
+// durationSimilarity is 1 for durations within a couple of seconds of each other (the same
+// recording is often a little longer or shorter on different services) and drops to 0 for
+// durations 15 seconds or more apart.
+func durationSimilarity(a time.Duration, b time.Duration) float64 {
+	const (
+		same      = 2 * time.Second
+		different = 15 * time.Second
+	)
+	difference := (a - b).Abs()
+	switch {
+	case difference <= same:
+		return 1
+	case difference >= different:
+		return 0
+	default:
+		return 1 - float64(difference-same)/float64(different-same)
+	}
+}
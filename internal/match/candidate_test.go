@@ -0,0 +1,201 @@
+package match
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestConfidence(t *testing.T) {
+	source := Candidate{
+		ISRC:     "USUM71703861",
+		Name:     "Song",
+		Artist:   "Band",
+		Album:    "Album",
+		Duration: 3*time.Minute + 30*time.Second,
+	}
+	tests := []struct {
+		name      string
+		candidate Candidate
+		match     bool
+	}{
+		{
+			name:      "same isrc",
+			candidate: Candidate{ISRC: "USUM71703861", Name: "Something Else", Artist: "Other"},
+			match:     true,
+		},
+		{
+			name: "same song",
+			candidate: Candidate{
+				Name:     "Song",
+				Artist:   "Band",
+				Album:    "Album",
+				Duration: 3*time.Minute + 30*time.Second,
+			},
+			match: true,
+		},
+		{
+			name: "explicit mismatch",
+			candidate: Candidate{
+				Name:     "Song",
+				Artist:   "Band",
+				Album:    "Album",
+				Duration: 3*time.Minute + 30*time.Second,
+				Explicit: true,
+			},
+			match: true,
+		},
+		{
+			name: "small duration difference",
+			candidate: Candidate{
+				Name:     "Song",
+				Artist:   "Band",
+				Album:    "Album",
+				Duration: 3*time.Minute + 34*time.Second,
+			},
+			match: true,
+		},
+		{
+			name: "featured artists",
+			candidate: Candidate{
+				Name:     "Song (feat. Singer)",
+				Artist:   "Band, Singer",
+				Album:    "Album",
+				Duration: 3*time.Minute + 31*time.Second,
+			},
+			match: true,
+		},
+		{
+			name: "karaoke",
+			candidate: Candidate{
+				Name:     "Song (Karaoke Version)",
+				Artist:   "Karaoke Hits Band",
+				Album:    "Karaoke Hits, Vol. 3",
+				Duration: 3*time.Minute + 28*time.Second,
+			},
+			match: false,
+		},
+		{
+			name: "karaoke credited to the artist",
+			candidate: Candidate{
+				Name:     "Song - Karaoke",
+				Artist:   "Band",
+				Album:    "Album",
+				Duration: 3*time.Minute + 30*time.Second,
+			},
+			match: false,
+		},
+		{
+			name: "live",
+			candidate: Candidate{
+				Name:     "Song - Live",
+				Artist:   "Band",
+				Album:    "Live at Wembley",
+				Duration: 4*time.Minute + 10*time.Second,
+			},
+			match: false,
+		},
+		{
+			name: "remaster",
+			candidate: Candidate{
+				Name:     "Song - 2011 Remaster",
+				Artist:   "Band",
+				Album:    "Album (Remastered)",
+				Duration: 3*time.Minute + 30*time.Second,
+			},
+			match: false,
+		},
+		{
+			name: "wrong artist",
+			candidate: Candidate{
+				Name:     "Song",
+				Artist:   "Other Band",
+				Album:    "Other Album",
+				Duration: 3*time.Minute + 5*time.Second,
+			},
+			match: false,
+		},
+		{
+			name: "wrong artist with the same duration",
+			candidate: Candidate{
+				Name:     "Song",
+				Artist:   "Other Band",
+				Album:    "Album",
+				Duration: 3*time.Minute + 30*time.Second,
+			},
+			match: false,
+		},
+	}
+	matcher := Matcher{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			confidence := matcher.Confidence(source, test.candidate)
+			if match := confidence >= DefaultConfidence; match != test.match {
+				t.Errorf("confidence = %.2f, want match = %t", confidence, test.match)
+			}
+		})
+	}
+}
+
+func TestConfidenceSameVersion(t *testing.T) {
+	source := Candidate{Name: "Song (Live)", Artist: "Band", Duration: 4 * time.Minute}
+	candidate := Candidate{Name: "Song - Live", Artist: "Band", Duration: 4 * time.Minute}
+	if confidence := (Matcher{}).Confidence(source, candidate); confidence < DefaultConfidence {
+		t.Errorf("confidence of the same live recording = %.2f", confidence)
+	}
+}
+
+func TestBest(t *testing.T) {
+	source := Candidate{Name: "Song", Artist: "Band", Album: "Album", Duration: 3 * time.Minute}
+	candidates := []Candidate{
+		{Name: "Song (Karaoke Version)", Artist: "Karaoke Hits", Duration: 3 * time.Minute},
+		{Name: "Song - Live", Artist: "Band", Duration: 4 * time.Minute},
+		{Name: "Song", Artist: "Band", Album: "Album", Duration: 3*time.Minute + time.Second},
+	}
+	best, confidence, ok := (Matcher{}).Best(source, candidates)
+	if best != 2 || !ok {
+		t.Errorf("Best = %d (%.2f, %t), want 2", best, confidence, ok)
+	}
+
+	best, _, ok = (Matcher{}).Best(source, candidates[:2])
+	if ok {
+		t.Errorf("Best = %d, want no candidate confident enough", best)
+	}
+
+	best, _, ok = (Matcher{}).Best(source, nil)
+	if best != -1 || ok {
+		t.Errorf("Best of no candidates = %d, %t, want -1, false", best, ok)
+	}
+
+	// a lower minimum confidence accepts the live recording
+	best, _, ok = (Matcher{MinConfidence: 0.1}).Best(source, candidates[1:2])
+	if best != 0 || !ok {
+		t.Errorf("Best with a low minimum confidence = %d, %t, want 0, true", best, ok)
+	}
+}
+
+func TestArtistOverlap(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want float64
+	}{
+		{"Band", "Band", 1},
+		{"Earth, Wind & Fire", "Earth, Wind & Fire", 1},
+		{"Tyler, The Creator", "Tyler, The Creator", 1},
+		{"Earth, Wind & Fire", "Earth", 1.0 / 3},
+		{"Tyler, The Creator", "Tyler", 0.5},
+		{"Future & Drake", "Future, Drake", 1},
+		{"Beyoncé feat. JAY-Z", "Beyoncé", 0.5},
+		{"Band & Band", "Band", 1},
+		{"Band, Band, Singer", "Band, Singer, Singer", 1},
+		{"Band", "Other", 0},
+		{"", "Band", 0},
+	}
+	for _, test := range tests {
+		got := artistOverlap(test.a, test.b)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("artistOverlap(%q, %q) = %.2f, want %.2f", test.a, test.b, got, test.want)
+		}
+	}
+}
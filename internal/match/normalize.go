@@ -0,0 +1,107 @@
+package match
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// parenthesized or bracketed featured artists, for example "(feat. Drake)" or "[with SZA]"
+	featuringRegex = regexp.MustCompile(`\s*[(\[](feat\.?|ft\.?|featuring|with)\s[^)\]]*[)\]]`)
+	// featured artists at the end of a name without brackets, for example "Song feat. Drake"
+	trailingFeaturingRegex = regexp.MustCompile(`\s+(feat\.?|ft\.?|featuring)\s.*$`)
+	// remaster notes, for example "- 2011 Remaster", "- Remastered 2009", or "(2015 Remaster)"
+	remasterRegex = regexp.MustCompile(
+		`\s*(-\s*|[(\[])(\d{4}\s+)?(digital(ly)?\s+)?remaster(ed)?(\s+version)?(\s+\d{4})?[)\]]?`,
+	)
+	// separators between multiple artists
+	artistSeparatorRegex = regexp.MustCompile(`\s*(,|&|\s+x\s+|\s+(feat\.?|ft\.?|featuring)\s+)\s*`)
+	// separators before featured artists. commas and ampersands are left out since they are also
+	// part of the names of artists like "Earth, Wind & Fire" and "Tyler, The Creator"
+	featuredSeparatorRegex = regexp.MustCompile(`\s+(feat\.?|ft\.?|featuring|with|x)\s+`)
+
+	quoteReplacer = strings.NewReplacer(
+		"‘", "'", "’", "'", "‛", "'", "′", "'", "`", "'",
+		"“", `"`, "”", `"`, "„", `"`, "″", `"`,
+		"–", "-", "—", "-",
+	)
+	// the transformer removing diacritics keeps state while it transforms a string, so every
+	// goroutine takes its own from the pool
+	diacritics = sync.Pool{
+		New: func() any {
+			return transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		},
+	}
+)
+
+// Name normalizes a song name so that the same recording with different metadata compares equal.
+// Case, diacritics, curly quotes, featured artists, remaster notes, and punctuation are all
+// removed.
+func Name(name string) string {
+	name = fold(name)
+	name = featuringRegex.ReplaceAllString(name, "")
+	name = trailingFeaturingRegex.ReplaceAllString(name, "")
+	name = remasterRegex.ReplaceAllString(name, "")
+	return clean(name)
+}
+
+// Artist normalizes an artist name the same way as Name. Featured artists are removed since
+// Spotify only exposes the first artist of a song while Apple Music joins all of them together.
+func Artist(artist string) string {
+	artist = fold(artist)
+	if primary := featuredSeparatorRegex.Split(artist, 2)[0]; primary != "" {
+		artist = primary
+	}
+	return clean(artist)
+}
+
+// Artists normalizes every artist in an artist name that joins multiple artists together, for
+// example "Future & Drake" or "Beyoncé feat. JAY-Z". Names with commas or ampersands in them are
+// split up too, so the artists should only be compared with other lists of artists.
+func Artists(artist string) []string {
+	artists := []string{}
+	for _, part := range artistSeparatorRegex.Split(fold(artist), -1) {
+		if part = clean(part); part != "" {
+			artists = append(artists, part)
+		}
+	}
+	return artists
+}
+
+// Key is a normalized key for a song name and artist that can be used to index songs.
+func Key(name string, artist string) string {
+	return NormalizedKey(Name(name), Artist(artist))
+}
+
+// NormalizedKey is Key for a name and artist that were already normalized with Name and Artist.
+func NormalizedKey(name string, artist string) string {
+	return name + "\x00" + artist
+}
+
+func fold(s string) string {
+	s = quoteReplacer.Replace(s)
+	transformer := diacritics.Get().(transform.Transformer)
+	defer diacritics.Put(transformer)
+	folded, _, err := transform.String(transformer, s)
+	if err == nil {
+		s = folded
+	}
+	return strings.ToLower(s)
+}
+
+// clean removes punctuation and collapses whitespace.
+func clean(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsSpace(r) {
+			return r
+		}
+		return -1
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,66 @@
+package match
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Song", "song"},
+		{"Café del Mar", "cafe del mar"},
+		{"Don’t Stop", "dont stop"},
+		{"Song (feat. Drake)", "song"},
+		{"Song [with SZA]", "song"},
+		{"Song feat. Drake", "song"},
+		{"Song - 2011 Remaster", "song"},
+		{"Song (Remastered 2009)", "song"},
+		{"  Song!  ", "song"},
+	}
+	for _, test := range tests {
+		if got := Name(test.name); got != test.want {
+			t.Errorf("Name(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestArtist(t *testing.T) {
+	tests := []struct {
+		artist string
+		want   string
+	}{
+		{"Beyoncé", "beyonce"},
+		{"Future & Drake", "future drake"},
+		{"Beyoncé feat. JAY-Z", "beyonce"},
+		{"Tyler, The Creator", "tyler the creator"},
+		{"Earth, Wind & Fire", "earth wind fire"},
+		{"Tyler, The Creator ft. Kali Uchis", "tyler the creator"},
+		{"Calvin Harris x Dua Lipa", "calvin harris"},
+		{"Silk Sonic with Bruno Mars", "silk sonic"},
+	}
+	for _, test := range tests {
+		if got := Artist(test.artist); got != test.want {
+			t.Errorf("Artist(%q) = %q, want %q", test.artist, got, test.want)
+		}
+	}
+}
+
+// TestKeyConcurrently is meant to be run with -race since normalizing is shared by every sync.
+func TestKeyConcurrently(t *testing.T) {
+	want := Key("Déjà Vu", "Beyoncé")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 200 {
+				if got := Key("Déjà Vu", "Beyoncé"); got != want {
+					t.Errorf("Key = %q, want %q", got, want)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package match
+
+// DefaultThreshold is the similarity that names and artists need to be considered the same when no
+// threshold is configured.
+const DefaultThreshold = 0.9
+
+// Matcher decides if two songs are the same based on their names and artists and scores search
+// results (see Confidence).
+type Matcher struct {
+	// Threshold is the minimum similarity (from 0 to 1) that both the normalized names and the
+	// normalized artists need to be the same song. A threshold of 1 only matches names and
+	// artists that are equal once normalized.
+	Threshold float64
+	// MinConfidence is the minimum confidence (from 0 to 1) that a search result needs to be
+	// accepted as a match.
+	MinConfidence float64
+}
+
+// Same reports if the two songs are similar enough to be the same recording.
+func (m Matcher) Same(nameA string, artistA string, nameB string, artistB string) bool {
+	_, ok := m.Score(nameA, artistA, nameB, artistB)
+	return ok
+}
+
+// Score returns how similar two songs are, which is the lower of the similarities of their names
+// and artists, and if that is at or above the threshold.
+func (m Matcher) Score(nameA string, artistA string, nameB string, artistB string) (float64, bool) {
+	return m.ScoreNormalized(Name(nameA), Artist(artistA), Name(nameB), Artist(artistB))
+}
+
+// ScoreNormalized is Score for names and artists that were already normalized with Name and
+// Artist, which saves normalizing the same song for every song it is compared with.
+func (m Matcher) ScoreNormalized(
+	nameA string,
+	artistA string,
+	nameB string,
+	artistB string,
+) (float64, bool) {
+	threshold := m.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	score := min(Similarity(nameA, nameB), Similarity(artistA, artistB))
+	return score, score >= threshold
+}
+
+// Similarity returns how similar two strings are from 0 (nothing in common) to 1 (equal) based on
+// the Levenshtein distance between them.
+func Similarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+	var (
+		runesA = []rune(a)
+		runesB = []rune(b)
+		length = max(len(runesA), len(runesB))
+	)
+	if length == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(runesA, runesB))/float64(length)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
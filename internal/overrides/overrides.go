@@ -0,0 +1,108 @@
+package overrides
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+)
+
+var spotifyIDRegex = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// Overrides are manual corrections to how songs are synced. Songs are identified by their ISRC or
+// their Apple Music catalog ID.
+type Overrides struct {
+	Pins       []Pin       `toml:"pin"`
+	Exclusions []Exclusion `toml:"exclude"`
+}
+
+// Pin always syncs an Apple Music song to a specific Spotify track instead of searching for it.
+type Pin struct {
+	ISRC         string `toml:"isrc"`
+	AppleMusicID string `toml:"apple_music"`
+	SpotifyID    string `toml:"spotify"`
+}
+
+// Exclusion stops a song from ever being synced. Playlist is the name or Apple Music ID of the
+// playlist to exclude the song from. Leave it empty to exclude the song from every playlist.
+type Exclusion struct {
+	ISRC         string `toml:"isrc"`
+	AppleMusicID string `toml:"apple_music"`
+	Playlist     string `toml:"playlist"`
+}
+
+// Load reads the overrides file at path. A missing file means there are no overrides.
+func Load(path string) (Overrides, error) {
+	var overrides Overrides
+	_, err := toml.DecodeFile(path, &overrides)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Overrides{}, nil
+	}
+	if err != nil {
+		return Overrides{}, fmt.Errorf("%w failed to decode %s", err, path)
+	}
+
+	err = overrides.Validate()
+	if err != nil {
+		return Overrides{}, fmt.Errorf("%w invalid overrides in %s", err, path)
+	}
+	return overrides, nil
+}
+
+// Validate checks that every override identifies a song and that every pin has a valid Spotify
+// track ID. All problems found are joined into the returned error.
+func (o Overrides) Validate() error {
+	var errs []error
+	for i, pin := range o.Pins {
+		if pin.ISRC == "" && pin.AppleMusicID == "" {
+			errs = append(errs, fmt.Errorf("pin #%d is missing an isrc or apple music id", i+1))
+		}
+		if !spotifyIDRegex.MatchString(pin.SpotifyID) {
+			errs = append(errs, fmt.Errorf("pin #%d has an invalid spotify id %q", i+1, pin.SpotifyID))
+		}
+	}
+	for i, exclusion := range o.Exclusions {
+		if exclusion.ISRC == "" && exclusion.AppleMusicID == "" {
+			errs = append(errs, fmt.Errorf("exclusion #%d is missing an isrc or apple music id", i+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pinned returns the Spotify track ID that the song is pinned to, if any.
+func (o Overrides) Pinned(song applemusic.Song) (string, bool) {
+	for _, pin := range o.Pins {
+		if matches(pin.ISRC, pin.AppleMusicID, song.ISRC, song.ID) {
+			return pin.SpotifyID, true
+		}
+	}
+	return "", false
+}
+
+// Excluded reports if the song with the given ISRC and Apple Music catalog ID (either can be
+// empty) should never be synced in the playlist with the given name and Apple Music ID.
+func (o Overrides) Excluded(
+	isrc string,
+	appleMusicID string,
+	playlist string,
+	playlistID string,
+) bool {
+	for _, exclusion := range o.Exclusions {
+		if exclusion.Playlist != "" && exclusion.Playlist != playlist &&
+			exclusion.Playlist != playlistID {
+			continue
+		}
+		if matches(exclusion.ISRC, exclusion.AppleMusicID, isrc, appleMusicID) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(isrc string, appleMusicID string, songISRC string, songAppleMusicID string) bool {
+	return (isrc != "" && isrc == songISRC) ||
+		(appleMusicID != "" && appleMusicID == songAppleMusicID)
+}
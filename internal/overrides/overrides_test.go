@@ -0,0 +1,179 @@
+package overrides
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+)
+
+const testSpotifyID = "4cOdK2wGLETKBW3PvgPWqT"
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    Overrides
+		wantErr bool
+	}{
+		{name: "missing file", want: Overrides{}},
+		{
+			name: "pins and exclusions",
+			file: `
+[[pin]]
+isrc = "USUM71703861"
+spotify = "` + testSpotifyID + `"
+
+[[exclude]]
+apple_music = "1440857781"
+playlist = "chill"
+`,
+			want: Overrides{
+				Pins:       []Pin{{ISRC: "USUM71703861", SpotifyID: testSpotifyID}},
+				Exclusions: []Exclusion{{AppleMusicID: "1440857781", Playlist: "chill"}},
+			},
+		},
+		{name: "invalid toml", file: "[[pin]", wantErr: true},
+		{name: "invalid override", file: "[[exclude]]\nplaylist = \"chill\"", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "overrides.toml")
+			if test.file != "" {
+				err := os.WriteFile(path, []byte(test.file), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Load(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Load() error = %v, want error %t", err, test.wantErr)
+			}
+			if len(got.Pins) != len(test.want.Pins) ||
+				len(got.Exclusions) != len(test.want.Exclusions) {
+				t.Fatalf("Load() = %+v, want %+v", got, test.want)
+			}
+			for i, pin := range got.Pins {
+				if pin != test.want.Pins[i] {
+					t.Errorf("pin #%d = %+v, want %+v", i+1, pin, test.want.Pins[i])
+				}
+			}
+			for i, exclusion := range got.Exclusions {
+				if exclusion != test.want.Exclusions[i] {
+					t.Errorf("exclusion #%d = %+v, want %+v", i+1, exclusion, test.want.Exclusions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides Overrides
+		want      []string
+	}{
+		{
+			name: "valid",
+			overrides: Overrides{
+				Pins:       []Pin{{AppleMusicID: "1", SpotifyID: testSpotifyID}},
+				Exclusions: []Exclusion{{ISRC: "USUM71703861"}},
+			},
+		},
+		{
+			name: "every problem",
+			overrides: Overrides{
+				Pins: []Pin{
+					{SpotifyID: testSpotifyID},
+					{ISRC: "USUM71703861", SpotifyID: "spotify:track:" + testSpotifyID},
+				},
+				Exclusions: []Exclusion{{Playlist: "chill"}},
+			},
+			want: []string{
+				"pin #1 is missing an isrc or apple music id",
+				"pin #2 has an invalid spotify id",
+				"exclusion #1 is missing an isrc or apple music id",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.overrides.Validate()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() = nil, want an error")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.want) {
+				t.Fatalf("Validate() = %q, want %d errors", err, len(test.want))
+			}
+			for i, want := range test.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("error #%d = %q, want %q", i+1, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPinned(t *testing.T) {
+	overrides := Overrides{Pins: []Pin{
+		{ISRC: "ISRC1", SpotifyID: "one"},
+		{AppleMusicID: "2", SpotifyID: "two"},
+	}}
+	tests := []struct {
+		song   applemusic.Song
+		want   string
+		wantOK bool
+	}{
+		{song: applemusic.Song{ID: "1", ISRC: "ISRC1"}, want: "one", wantOK: true},
+		{song: applemusic.Song{ID: "2", ISRC: "ISRC2"}, want: "two", wantOK: true},
+		{song: applemusic.Song{ID: "3", ISRC: "ISRC3"}},
+		// empty isrcs never match a pin by apple music id
+		{song: applemusic.Song{ID: "3"}},
+	}
+	for _, test := range tests {
+		got, ok := overrides.Pinned(test.song)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("Pinned(%+v) = %q, %t, want %q, %t", test.song, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	overrides := Overrides{Exclusions: []Exclusion{
+		{ISRC: "ISRC1"},
+		{AppleMusicID: "2", Playlist: "chill"},
+		{ISRC: "ISRC3", Playlist: "p.rap"},
+	}}
+	tests := []struct {
+		name         string
+		isrc         string
+		appleMusicID string
+		playlist     string
+		playlistID   string
+		want         bool
+	}{
+		{name: "every playlist", isrc: "ISRC1", playlist: "rap", playlistID: "p.rap", want: true},
+		{name: "playlist name", appleMusicID: "2", playlist: "chill", playlistID: "p.chill", want: true},
+		{name: "other playlist", appleMusicID: "2", playlist: "rap", playlistID: "p.rap"},
+		{name: "playlist id", isrc: "ISRC3", playlist: "rap", playlistID: "p.rap", want: true},
+		{name: "not excluded", isrc: "ISRC4", appleMusicID: "4", playlist: "rap", playlistID: "p.rap"},
+		{name: "nothing to match", playlist: "rap", playlistID: "p.rap"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := overrides.Excluded(test.isrc, test.appleMusicID, test.playlist, test.playlistID)
+			if got != test.want {
+				t.Errorf("Excluded() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
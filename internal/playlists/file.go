@@ -0,0 +1,25 @@
+package playlists
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FileSource loads playlists from the [[playlists]] entries of a local TOML config file.
+type FileSource struct {
+	Path string
+}
+
+type fileConfig struct {
+	Playlists []Playlist `toml:"playlists"`
+}
+
+func (s FileSource) Playlists() ([]Playlist, error) {
+	var config fileConfig
+	_, err := toml.DecodeFile(s.Path, &config)
+	if err != nil {
+		return []Playlist{}, fmt.Errorf("%w failed to decode %s", err, s.Path)
+	}
+	return config.Playlists, nil
+}
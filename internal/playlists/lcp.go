@@ -0,0 +1,31 @@
+package playlists
+
+import (
+	"fmt"
+
+	"go.mattglei.ch/lcp/pkg/lcp"
+)
+
+// LcpSource loads playlists from the lcp API.
+type LcpSource struct {
+	Client *lcp.Client
+}
+
+func (s LcpSource) Playlists() ([]Playlist, error) {
+	lcpPlaylists, err := lcp.FetchAppleMusicSyncedPlaylists(s.Client)
+	if err != nil {
+		return []Playlist{}, fmt.Errorf("%w failed to fetch playlists to sync from lcp", err)
+	}
+
+	playlists := []Playlist{}
+	for _, playlist := range lcpPlaylists {
+		playlists = append(playlists, Playlist{
+			Name:         playlist.Name,
+			AppleMusicID: playlist.AppleMusicID,
+			SpotifyID:    playlist.SpotifyID,
+			NoSync:       playlist.NoSync,
+			Private:      playlist.Private,
+		})
+	}
+	return playlists, nil
+}
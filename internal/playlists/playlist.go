@@ -0,0 +1,26 @@
+package playlists
+
+import (
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/diff"
+)
+
+// Playlist is a single Apple Music playlist that is mirrored to a Spotify playlist.
+type Playlist struct {
+	Name         string `toml:"name"`
+	AppleMusicID string `toml:"apple_music"`
+	SpotifyID    string `toml:"spotify"`
+	NoSync       bool   `toml:"no_sync"`
+	Private      bool   `toml:"private"`
+
+	// Bidirectional also mirrors songs added to the Spotify playlist back into Apple Music.
+	Bidirectional  bool                `toml:"bidirectional"`
+	ConflictPolicy diff.ConflictPolicy `toml:"conflict_policy"`
+
+	// Interval is how often the playlist is synced, for example "5m" or "24h". Cron is a cron
+	// expression of when to sync it instead, for example "0 4 * * *". Playlists without either
+	// use the default interval from the config.
+	Interval time.Duration `toml:"interval"`
+	Cron     string        `toml:"cron"`
+}
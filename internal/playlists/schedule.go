@@ -0,0 +1,54 @@
+package playlists
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns when the playlist should be synced. Cron expressions are evaluated in the given
+// location unless they set their own with a CRON_TZ= prefix. Playlists without an interval or
+// cron expression are synced every defaultInterval.
+func (p Playlist) Schedule(
+	defaultInterval time.Duration,
+	location *time.Location,
+) (cron.Schedule, error) {
+	switch {
+	case p.Cron != "":
+		expression := p.Cron
+		if !strings.HasPrefix(expression, "CRON_TZ=") && !strings.HasPrefix(expression, "TZ=") {
+			expression = fmt.Sprintf("CRON_TZ=%s %s", location, expression)
+		}
+		schedule, err := cron.ParseStandard(expression)
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to parse cron expression %q", err, p.Cron)
+		}
+		return schedule, nil
+	case p.Interval != 0:
+		return cron.Every(p.Interval), nil
+	default:
+		return cron.Every(defaultInterval), nil
+	}
+}
+
+func validateSchedule(playlist Playlist) error {
+	if playlist.Cron != "" && playlist.Interval != 0 {
+		return errors.New("has both an interval and a cron expression")
+	}
+	if playlist.Interval < 0 {
+		return fmt.Errorf("has a negative interval %s", playlist.Interval)
+	}
+	if playlist.Interval != 0 && playlist.Interval < time.Second {
+		return fmt.Errorf("has an interval %s shorter than a second", playlist.Interval)
+	}
+	if playlist.Cron != "" {
+		_, err := cron.ParseStandard(playlist.Cron)
+		if err != nil {
+			return fmt.Errorf("has an invalid cron expression %q: %w", playlist.Cron, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package playlists
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-01-15 12:00 in new york
+	from := time.Date(2026, time.January, 15, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		playlist Playlist
+		want     time.Time
+		wantErr  bool
+	}{
+		{name: "default interval", playlist: Playlist{}, want: from.Add(time.Hour)},
+		{
+			name:     "interval",
+			playlist: Playlist{Interval: 5 * time.Minute},
+			want:     from.Add(5 * time.Minute),
+		},
+		{
+			name:     "cron in the given location",
+			playlist: Playlist{Cron: "0 4 * * *"},
+			want:     time.Date(2026, time.January, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron with its own location",
+			playlist: Playlist{Cron: "CRON_TZ=UTC 0 4 * * *"},
+			want:     time.Date(2026, time.January, 16, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron with TZ",
+			playlist: Playlist{Cron: "TZ=Asia/Tokyo 0 4 * * *"},
+			want:     time.Date(2026, time.January, 15, 19, 0, 0, 0, time.UTC),
+		},
+		{name: "invalid cron", playlist: Playlist{Cron: "every day"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := test.playlist.Schedule(time.Hour, newYork)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Schedule() error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if next := schedule.Next(from); !next.Equal(test.want) {
+				t.Errorf("next run = %s, want %s", next.UTC(), test.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist Playlist
+		wantErr  bool
+	}{
+		{name: "default", playlist: Playlist{}},
+		{name: "interval", playlist: Playlist{Interval: time.Minute}},
+		{name: "cron", playlist: Playlist{Cron: "*/5 * * * *"}},
+		{name: "cron with location", playlist: Playlist{Cron: "CRON_TZ=UTC 0 4 * * *"}},
+		{
+			name:     "interval and cron",
+			playlist: Playlist{Interval: time.Minute, Cron: "0 4 * * *"},
+			wantErr:  true,
+		},
+		{name: "negative interval", playlist: Playlist{Interval: -time.Minute}, wantErr: true},
+		{name: "interval under a second", playlist: Playlist{Interval: time.Millisecond}, wantErr: true},
+		{name: "invalid cron", playlist: Playlist{Cron: "0 4 * *"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSchedule(test.playlist)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateSchedule() = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package playlists
+
+// Source provides the list of playlists that should be synced.
+type Source interface {
+	Playlists() ([]Playlist, error)
+}
+
+type mergedSource struct {
+	sources []Source
+}
+
+// Merge combines multiple sources into one. Playlists are returned in the order they are first
+// seen, and when two sources define a playlist with the same Apple Music ID the entry from the
+// later source wins.
+func Merge(sources ...Source) Source {
+	return mergedSource{sources: sources}
+}
+
+func (m mergedSource) Playlists() ([]Playlist, error) {
+	var (
+		merged  []Playlist
+		indexes = map[string]int{}
+	)
+	for _, source := range m.sources {
+		playlists, err := source.Playlists()
+		if err != nil {
+			return []Playlist{}, err
+		}
+		for _, playlist := range playlists {
+			if i, ok := indexes[playlist.AppleMusicID]; ok {
+				merged[i] = playlist
+				continue
+			}
+			indexes[playlist.AppleMusicID] = len(merged)
+			merged = append(merged, playlist)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,118 @@
+package playlists
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type staticSource struct {
+	playlists []Playlist
+	err       error
+}
+
+func (s staticSource) Playlists() ([]Playlist, error) {
+	return s.playlists, s.err
+}
+
+func TestMerge(t *testing.T) {
+	var (
+		lcp = staticSource{playlists: []Playlist{
+			{Name: "chill", AppleMusicID: "p.chill", SpotifyID: "lcp-chill"},
+			{Name: "rap", AppleMusicID: "p.rap", SpotifyID: "lcp-rap"},
+		}}
+		local = staticSource{playlists: []Playlist{
+			{Name: "house", AppleMusicID: "p.house", SpotifyID: "local-house"},
+			{Name: "chill", AppleMusicID: "p.chill", SpotifyID: "local-chill", NoSync: true},
+		}}
+		failing = staticSource{err: errors.New("lcp is down")}
+	)
+
+	tests := []struct {
+		name    string
+		sources []Source
+		want    []Playlist
+		wantErr bool
+	}{
+		{name: "no sources", want: nil},
+		{name: "one source", sources: []Source{lcp}, want: lcp.playlists},
+		{
+			name:    "later source wins",
+			sources: []Source{lcp, local},
+			want: []Playlist{
+				{Name: "chill", AppleMusicID: "p.chill", SpotifyID: "local-chill", NoSync: true},
+				{Name: "rap", AppleMusicID: "p.rap", SpotifyID: "lcp-rap"},
+				{Name: "house", AppleMusicID: "p.house", SpotifyID: "local-house"},
+			},
+		},
+		{
+			name:    "earlier source wins when it's last",
+			sources: []Source{local, lcp},
+			want: []Playlist{
+				{Name: "house", AppleMusicID: "p.house", SpotifyID: "local-house"},
+				{Name: "chill", AppleMusicID: "p.chill", SpotifyID: "lcp-chill"},
+				{Name: "rap", AppleMusicID: "p.rap", SpotifyID: "lcp-rap"},
+			},
+		},
+		{name: "failing source", sources: []Source{local, failing}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Merge(test.sources...).Playlists()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %t", err, test.wantErr)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(`
+[matching]
+threshold = 0.9
+
+[[playlists]]
+name = "chill"
+apple_music = "p.AWXoZoxHLrvpJlY"
+spotify = "5SnoWhWIJRmJNkvdxCpMAe"
+
+[[playlists]]
+name = "rap"
+apple_music = "p.qQXLxPpFA75zg8e"
+spotify = "6MLAGkQPdSBMjit5O1hrws"
+no_sync = true
+private = true
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FileSource{Path: path}.Playlists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Playlist{
+		{Name: "chill", AppleMusicID: "p.AWXoZoxHLrvpJlY", SpotifyID: "5SnoWhWIJRmJNkvdxCpMAe"},
+		{
+			Name:         "rap",
+			AppleMusicID: "p.qQXLxPpFA75zg8e",
+			SpotifyID:    "6MLAGkQPdSBMjit5O1hrws",
+			NoSync:       true,
+			Private:      true,
+		},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	_, err = FileSource{Path: filepath.Join(t.TempDir(), "missing.toml")}.Playlists()
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,137 @@
+package playlists
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var spotifyIDRegex = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// Validate checks that every playlist has the fields required to sync it and that no Apple Music
+// or Spotify playlist is used more than once. All problems found are joined into the returned
+// error.
+func Validate(playlists []Playlist) error {
+	var (
+		errs          []error
+		appleMusicIDs = map[string]string{}
+		spotifyIDs    = map[string]string{}
+	)
+	for i, playlist := range playlists {
+		label := playlist.Name
+		if strings.TrimSpace(label) == "" {
+			label = fmt.Sprintf("playlist #%d", i+1)
+			errs = append(errs, fmt.Errorf("%s is missing a name", label))
+		}
+
+		switch {
+		case playlist.AppleMusicID == "":
+			errs = append(errs, fmt.Errorf("%q is missing an apple music id", label))
+		case !strings.HasPrefix(playlist.AppleMusicID, "p."):
+			errs = append(errs, fmt.Errorf(
+				"%q has an invalid apple music library id %q",
+				label,
+				playlist.AppleMusicID,
+			))
+		default:
+			if other, ok := appleMusicIDs[playlist.AppleMusicID]; ok {
+				errs = append(errs, fmt.Errorf(
+					"%q and %q both use apple music playlist %s",
+					other,
+					label,
+					playlist.AppleMusicID,
+				))
+			}
+			appleMusicIDs[playlist.AppleMusicID] = label
+		}
+
+		switch {
+		case playlist.SpotifyID == "":
+			errs = append(errs, fmt.Errorf("%q is missing a spotify id", label))
+		case !spotifyIDRegex.MatchString(playlist.SpotifyID):
+			errs = append(
+				errs,
+				fmt.Errorf("%q has an invalid spotify id %q", label, playlist.SpotifyID),
+			)
+		default:
+			if other, ok := spotifyIDs[playlist.SpotifyID]; ok {
+				errs = append(errs, fmt.Errorf(
+					"%q and %q both use spotify playlist %s",
+					other,
+					label,
+					playlist.SpotifyID,
+				))
+			}
+			spotifyIDs[playlist.SpotifyID] = label
+		}
+
+		if !playlist.ConflictPolicy.Valid() {
+			errs = append(
+				errs,
+				fmt.Errorf("%q has an unknown conflict policy %q", label, playlist.ConflictPolicy),
+			)
+		}
+		err := validateSchedule(playlist)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q %w", label, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Diff describes the changes between two playlist lists, one line per added, removed, or changed
+// playlist. Playlists are matched up by their Apple Music ID.
+func Diff(current []Playlist, proposed []Playlist) []string {
+	var (
+		lines       []string
+		currentByID = map[string]Playlist{}
+		proposedIDs = map[string]bool{}
+	)
+	for _, playlist := range current {
+		currentByID[playlist.AppleMusicID] = playlist
+	}
+
+	for _, playlist := range proposed {
+		proposedIDs[playlist.AppleMusicID] = true
+		previous, ok := currentByID[playlist.AppleMusicID]
+		if !ok {
+			lines = append(lines, fmt.Sprintf(
+				"+ %q (apple music: %s, spotify: %s)",
+				playlist.Name,
+				playlist.AppleMusicID,
+				playlist.SpotifyID,
+			))
+			continue
+		}
+		if previous == playlist {
+			continue
+		}
+
+		var changes []string
+		change := func(field string, from any, to any) {
+			if from != to {
+				changes = append(changes, fmt.Sprintf("%s %v -> %v", field, from, to))
+			}
+		}
+		change("name", previous.Name, playlist.Name)
+		change("spotify", previous.SpotifyID, playlist.SpotifyID)
+		change("no_sync", previous.NoSync, playlist.NoSync)
+		change("private", previous.Private, playlist.Private)
+		change("bidirectional", previous.Bidirectional, playlist.Bidirectional)
+		change("conflict_policy", previous.ConflictPolicy, playlist.ConflictPolicy)
+		change("interval", previous.Interval, playlist.Interval)
+		change("cron", previous.Cron, playlist.Cron)
+		lines = append(lines, fmt.Sprintf("~ %q: %s", playlist.Name, strings.Join(changes, ", ")))
+	}
+
+	for _, playlist := range current {
+		if !proposedIDs[playlist.AppleMusicID] {
+			lines = append(
+				lines,
+				fmt.Sprintf("- %q (apple music: %s)", playlist.Name, playlist.AppleMusicID),
+			)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,147 @@
+package playlists
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var (
+		chill = Playlist{
+			Name:         "chill",
+			AppleMusicID: "p.AWXoZoxHLrvpJlY",
+			SpotifyID:    "5SnoWhWIJRmJNkvdxCpMAe",
+		}
+		rap = Playlist{
+			Name:         "rap",
+			AppleMusicID: "p.qQXLxPpFA75zg8e",
+			SpotifyID:    "6MLAGkQPdSBMjit5O1hrws",
+		}
+	)
+	with := func(playlist Playlist, change func(*Playlist)) Playlist {
+		change(&playlist)
+		return playlist
+	}
+
+	tests := []struct {
+		name      string
+		playlists []Playlist
+		// wantErrs are parts of the error, one for every problem found
+		wantErrs []string
+	}{
+		{name: "valid", playlists: []Playlist{chill, rap}},
+		{name: "empty", playlists: nil},
+		{
+			name:      "missing name",
+			playlists: []Playlist{with(chill, func(p *Playlist) { p.Name = " " })},
+			wantErrs:  []string{"playlist #1 is missing a name"},
+		},
+		{
+			name:      "missing ids",
+			playlists: []Playlist{{Name: "empty"}},
+			wantErrs:  []string{"missing an apple music id", "missing a spotify id"},
+		},
+		{
+			name: "catalog id instead of library id",
+			playlists: []Playlist{
+				with(chill, func(p *Playlist) { p.AppleMusicID = "pl.u-AkAmPlyUxRJGZ9" }),
+			},
+			wantErrs: []string{`invalid apple music library id "pl.u-AkAmPlyUxRJGZ9"`},
+		},
+		{
+			name: "spotify url instead of id",
+			playlists: []Playlist{with(chill, func(p *Playlist) {
+				p.SpotifyID = "https://open.spotify.com/playlist/5SnoWhWIJRmJNkvdxCpMAe"
+			})},
+			wantErrs: []string{"invalid spotify id"},
+		},
+		{
+			name:      "short spotify id",
+			playlists: []Playlist{with(chill, func(p *Playlist) { p.SpotifyID = "5SnoWhWIJRmJNkvdxCpMA" })},
+			wantErrs:  []string{"invalid spotify id"},
+		},
+		{
+			name: "duplicate ids",
+			playlists: []Playlist{
+				chill,
+				with(chill, func(p *Playlist) { p.Name = "copy" }),
+			},
+			wantErrs: []string{
+				`"chill" and "copy" both use apple music playlist`,
+				`"chill" and "copy" both use spotify playlist`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.playlists)
+			if len(test.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors containing %q", test.wantErrs)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.wantErrs) {
+				t.Errorf("got %d errors, want %d: %v", len(lines), len(test.wantErrs), err)
+			}
+			for _, want := range test.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var (
+		chill = Playlist{Name: "chill", AppleMusicID: "p.chill", SpotifyID: "chill"}
+		rap   = Playlist{Name: "rap", AppleMusicID: "p.rap", SpotifyID: "rap"}
+		house = Playlist{Name: "house", AppleMusicID: "p.house", SpotifyID: "house"}
+	)
+	renamed := chill
+	renamed.Name = "chill out"
+	renamed.NoSync = true
+
+	tests := []struct {
+		name     string
+		current  []Playlist
+		proposed []Playlist
+		want     []string
+	}{
+		{name: "unchanged", current: []Playlist{chill, rap}, proposed: []Playlist{rap, chill}},
+		{
+			name:     "added and removed",
+			current:  []Playlist{chill, rap},
+			proposed: []Playlist{chill, house},
+			want: []string{
+				`+ "house" (apple music: p.house, spotify: house)`,
+				`- "rap" (apple music: p.rap)`,
+			},
+		},
+		{
+			name:     "changed",
+			current:  []Playlist{chill},
+			proposed: []Playlist{renamed},
+			want:     []string{`~ "chill out": name chill -> chill out, no_sync false -> true`},
+		},
+		{
+			name:     "first load",
+			proposed: []Playlist{chill},
+			want:     []string{`+ "chill" (apple music: p.chill, spotify: chill)`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(test.current, test.proposed)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
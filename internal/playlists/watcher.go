@@ -0,0 +1,146 @@
+package playlists
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.mattglei.ch/timber"
+)
+
+// Watcher keeps the most recently loaded and validated list of playlists from a Source. The list
+// is reloaded whenever one of the watched files changes, every poll interval (if set), or when
+// Reload is called directly. A reload that fails or produces an invalid list is rejected and the
+// previous list is kept.
+type Watcher struct {
+	Source       Source
+	Files        []string
+	PollInterval time.Duration
+
+	mutex     sync.RWMutex
+	playlists []Playlist
+}
+
+// Current returns the playlists from the last successful reload.
+func (w *Watcher) Current() []Playlist {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.playlists
+}
+
+// Reload loads the playlists from the source, validates them, and applies them if they are valid.
+func (w *Watcher) Reload() error {
+	proposed, err := w.Source.Playlists()
+	if err != nil {
+		return fmt.Errorf("%w failed to load playlists", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	changes := Diff(w.playlists, proposed)
+	err = Validate(proposed)
+	if err != nil {
+		timber.Warning("rejected playlist configuration with the following changes:")
+		for _, change := range changes {
+			timber.Warning(change)
+		}
+		return fmt.Errorf("%w invalid playlist configuration", err)
+	}
+
+	if len(changes) != 0 && w.playlists != nil {
+		timber.Info("applied playlist configuration changes:")
+		for _, change := range changes {
+			timber.Info(change)
+		}
+	}
+	w.playlists = proposed
+	return nil
+}
+
+// Watch starts reloading the playlists in the background whenever a watched file changes or the
+// poll interval elapses.
+func (w *Watcher) Watch() error {
+	if len(w.Files) != 0 {
+		fileWatcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("%w failed to create file watcher", err)
+		}
+		// directories are watched instead of the files themselves as most editors save by
+		// replacing the file, which would otherwise silently stop the watch
+		watched := map[string]bool{}
+		for _, file := range w.Files {
+			dir := filepath.Dir(file)
+			if watched[dir] {
+				continue
+			}
+			err = fileWatcher.Add(dir)
+			if err != nil {
+				return fmt.Errorf("%w failed to watch %s", err, dir)
+			}
+			watched[dir] = true
+		}
+		go w.watchFiles(fileWatcher)
+	}
+
+	if w.PollInterval > 0 {
+		go w.poll()
+	}
+	return nil
+}
+
+func (w *Watcher) watchFiles(fileWatcher *fsnotify.Watcher) {
+	var debounce *time.Timer
+	for {
+		select {
+		case event, ok := <-fileWatcher.Events:
+			if !ok {
+				return
+			}
+			if !w.isWatchedFile(event.Name) {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			// editors often write a file in multiple steps so wait for things to settle
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(500*time.Millisecond, func() {
+				timber.Info("detected change to", event.Name)
+				err := w.Reload()
+				if err != nil {
+					timber.Warning("failed to reload playlists", err.Error())
+				}
+			})
+		case err, ok := <-fileWatcher.Errors:
+			if !ok {
+				return
+			}
+			timber.Warning("file watcher error", err.Error())
+		}
+	}
+}
+
+func (w *Watcher) isWatchedFile(name string) bool {
+	for _, file := range w.Files {
+		if filepath.Clean(file) == filepath.Clean(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) poll() {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := w.Reload()
+		if err != nil {
+			timber.Warning("failed to reload playlists", err.Error())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package playlists
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSource counts how many times the playlists were loaded from a source.
+type countingSource struct {
+	Source
+
+	mutex sync.Mutex
+	loads int
+}
+
+func (s *countingSource) Playlists() ([]Playlist, error) {
+	s.mutex.Lock()
+	s.loads++
+	s.mutex.Unlock()
+	return s.Source.Playlists()
+}
+
+func (s *countingSource) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.loads
+}
+
+// switchableSource returns whichever playlists were set last.
+type switchableSource struct {
+	mutex     sync.Mutex
+	playlists []Playlist
+}
+
+func (s *switchableSource) Playlists() ([]Playlist, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.playlists, nil
+}
+
+func (s *switchableSource) set(playlists ...Playlist) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.playlists = playlists
+}
+
+// eventually fails the test if condition doesn't become true within a few seconds.
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func playlistsFile(name string, spotifyID string) string {
+	return `
+[[playlists]]
+name = "` + name + `"
+apple_music = "p.AWXoZoxHLrvpJlY"
+spotify = "` + spotifyID + `"
+`
+}
+
+func TestWatcherReload(t *testing.T) {
+	valid := Playlist{
+		Name:         "chill",
+		AppleMusicID: "p.AWXoZoxHLrvpJlY",
+		SpotifyID:    "5SnoWhWIJRmJNkvdxCpMAe",
+	}
+	source := &switchableSource{}
+	source.set(valid)
+	watcher := &Watcher{Source: source}
+
+	err := watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := watcher.Current(); len(got) != 1 || got[0] != valid {
+		t.Fatalf("got %+v after the first reload", got)
+	}
+
+	invalid := valid
+	invalid.SpotifyID = "not a spotify id"
+	source.set(invalid)
+	err = watcher.Reload()
+	if err == nil {
+		t.Fatal("expected an error for the invalid playlist")
+	}
+	if got := watcher.Current(); len(got) != 1 || got[0] != valid {
+		t.Errorf("invalid playlists replaced the previous ones: %+v", got)
+	}
+}
+
+func TestWatcherDebouncesFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(playlistsFile("chill", "5SnoWhWIJRmJNkvdxCpMAe")), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &countingSource{Source: FileSource{Path: path}}
+	watcher := &Watcher{Source: source, Files: []string{path}}
+	err = watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = watcher.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an editor saving the file in several writes
+	for _, name := range []string{"one", "two", "three"} {
+		err = os.WriteFile(path, []byte(playlistsFile(name, "5SnoWhWIJRmJNkvdxCpMAe")), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// files next to the config are ignored
+	err = os.WriteFile(filepath.Join(filepath.Dir(path), "other.toml"), []byte("x"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool {
+		current := watcher.Current()
+		return len(current) == 1 && current[0].Name == "three"
+	}, "the change to the config file wasn't picked up")
+	time.Sleep(time.Second)
+	if loads := source.count(); loads != 2 {
+		t.Errorf("loaded the playlists %d times, want 2 (the first reload and the change)", loads)
+	}
+}
+
+func TestWatcherPolls(t *testing.T) {
+	chill := Playlist{
+		Name:         "chill",
+		AppleMusicID: "p.AWXoZoxHLrvpJlY",
+		SpotifyID:    "5SnoWhWIJRmJNkvdxCpMAe",
+	}
+	source := &switchableSource{}
+	source.set(chill)
+	watcher := &Watcher{Source: source, PollInterval: 10 * time.Millisecond}
+	err := watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = watcher.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paused := chill
+	paused.NoSync = true
+	source.set(paused)
+	eventually(t, func() bool {
+		current := watcher.Current()
+		return len(current) == 1 && current[0].NoSync
+	}, "polling didn't pick up the paused playlist")
+}
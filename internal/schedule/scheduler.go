@@ -0,0 +1,253 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+// Scheduler keeps track of when each playlist is next due to be synced. Next runs are saved to
+// File so a restart picks up where the last process left off instead of syncing every playlist
+// at once, and so they can be shown by the schedule command.
+type Scheduler struct {
+	File *store.File[store.Schedule]
+	// DefaultInterval is how often playlists without their own schedule are synced.
+	DefaultInterval time.Duration
+	// Jitter is the maximum random delay added to every run so playlists with the same schedule
+	// aren't all synced at the same moment.
+	Jitter time.Duration
+	// Location is the time zone cron expressions are evaluated in.
+	Location *time.Location
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	playlist playlists.Playlist
+	schedule cron.Schedule
+	lastRun  time.Time
+	nextRun  time.Time
+	running  bool
+	// disabled is why the playlist isn't being synced, if it has been disabled.
+	disabled string
+}
+
+// Update replaces the scheduled playlists with the given ones. Paused playlists are left out. New
+// playlists are due right away (plus jitter) unless a next run was saved for them, and playlists
+// whose schedule changed are rescheduled from now. Nothing is changed if any of the schedules are
+// invalid.
+func (s *Scheduler) Update(current []playlists.Playlist) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if s.entries == nil {
+		err := s.restore()
+		if err != nil {
+			return err
+		}
+	}
+
+	schedules := map[string]cron.Schedule{}
+	for _, playlist := range current {
+		if playlist.NoSync {
+			continue
+		}
+		schedule, err := playlist.Schedule(s.DefaultInterval, s.Location)
+		if err != nil {
+			return fmt.Errorf("%w failed to schedule %s", err, playlist.Name)
+		}
+		schedules[playlist.AppleMusicID] = schedule
+	}
+
+	for _, playlist := range current {
+		schedule, ok := schedules[playlist.AppleMusicID]
+		if !ok {
+			continue
+		}
+		existing, ok := s.entries[playlist.AppleMusicID]
+		switch {
+		case !ok:
+			s.entries[playlist.AppleMusicID] = &entry{
+				playlist: playlist,
+				schedule: schedule,
+				nextRun:  now.Add(s.jitter()),
+			}
+		case existing.schedule == nil:
+			// restored from the file, so only run it sooner if its schedule got shorter
+			existing.playlist = playlist
+			existing.schedule = schedule
+			existing.nextRun = earliest(existing.nextRun, schedule.Next(now).Add(s.jitter()))
+		default:
+			scheduleChanged := existing.playlist.Interval != playlist.Interval ||
+				existing.playlist.Cron != playlist.Cron
+			if existing.disabled != "" && existing.playlist.SpotifyID != playlist.SpotifyID {
+				existing.disabled = ""
+				existing.nextRun = now.Add(s.jitter())
+			}
+			existing.playlist = playlist
+			if scheduleChanged {
+				existing.schedule = schedule
+				existing.nextRun = schedule.Next(now).Add(s.jitter())
+			}
+		}
+	}
+	for id, entry := range s.entries {
+		if _, ok := schedules[id]; !ok && !entry.running {
+			delete(s.entries, id)
+		}
+	}
+	return s.save()
+}
+
+// Due returns the playlists that are due to be synced at now and marks them as running until
+// Finished is called for them.
+func (s *Scheduler) Due(now time.Time) []playlists.Playlist {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	due := []playlists.Playlist{}
+	for _, entry := range s.entries {
+		if entry.schedule != nil && !entry.running && entry.disabled == "" &&
+			!entry.nextRun.After(now) {
+			entry.running = true
+			due = append(due, entry.playlist)
+		}
+	}
+	slices.SortFunc(due, func(a, b playlists.Playlist) int {
+		return s.entries[a.AppleMusicID].nextRun.Compare(s.entries[b.AppleMusicID].nextRun)
+	})
+	return due
+}
+
+// Finished schedules the next run of a playlist after a sync of it finished at the given time and
+// returns when that next run is.
+func (s *Scheduler) Finished(id string, at time.Time) (time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return time.Time{}, nil
+	}
+	entry.running = false
+	entry.lastRun = at
+	entry.nextRun = entry.schedule.Next(at).Add(s.jitter())
+	return entry.nextRun, s.save()
+}
+
+// Disable stops syncing a running playlist until its Spotify ID changes or the process restarts.
+// reason is saved with the schedule.
+func (s *Scheduler) Disable(id string, reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil
+	}
+	entry.running = false
+	entry.disabled = reason
+	return s.save()
+}
+
+// NextRun returns when the next playlist that isn't already running is due. False is returned if
+// there are no playlists waiting to be synced.
+func (s *Scheduler) NextRun() (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var next time.Time
+	for _, entry := range s.entries {
+		if entry.schedule != nil && !entry.running && entry.disabled == "" {
+			next = earliest(next, entry.nextRun)
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Upcoming returns the last and next run of every scheduled playlist, soonest first.
+func (s *Scheduler) Upcoming() []store.ScheduledRun {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return Upcoming(s.runs())
+}
+
+// Upcoming sorts the runs of a saved schedule, soonest first.
+func Upcoming(schedule store.Schedule) []store.ScheduledRun {
+	runs := make([]store.ScheduledRun, 0, len(schedule))
+	for _, run := range schedule {
+		runs = append(runs, run)
+	}
+	slices.SortFunc(runs, func(a, b store.ScheduledRun) int {
+		return a.NextRun.Compare(b.NextRun)
+	})
+	return runs
+}
+
+func (s *Scheduler) runs() store.Schedule {
+	runs := make(store.Schedule, len(s.entries))
+	for id, entry := range s.entries {
+		if entry.schedule != nil {
+			runs[id] = store.ScheduledRun{
+				Playlist: entry.playlist.Name,
+				LastRun:  entry.lastRun,
+				NextRun:  entry.nextRun,
+				Disabled: entry.disabled,
+			}
+		}
+	}
+	return runs
+}
+
+func (s *Scheduler) restore() error {
+	s.entries = map[string]*entry{}
+	if s.File == nil {
+		return nil
+	}
+	saved, err := s.File.Load()
+	if err != nil {
+		return fmt.Errorf("%w failed to load schedule", err)
+	}
+	for id, run := range saved {
+		s.entries[id] = &entry{
+			playlist: playlists.Playlist{Name: run.Playlist, AppleMusicID: id},
+			lastRun:  run.LastRun,
+			nextRun:  run.NextRun,
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) save() error {
+	if s.File == nil {
+		return nil
+	}
+	err := s.File.Save(s.runs())
+	if err != nil {
+		return fmt.Errorf("%w failed to save schedule", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) jitter() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.Jitter)
+}
+
+// earliest returns the earlier of two times, ignoring a zero a.
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
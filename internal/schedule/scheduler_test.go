@@ -0,0 +1,244 @@
+package schedule
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/playlists"
+	"go.mattglei.ch/musicsync/internal/store"
+)
+
+func newTestScheduler(t *testing.T, jitter time.Duration) *Scheduler {
+	t.Helper()
+	return &Scheduler{
+		File:            &store.File[store.Schedule]{Path: filepath.Join(t.TempDir(), "schedule.json")},
+		DefaultInterval: time.Hour,
+		Jitter:          jitter,
+		Location:        time.UTC,
+	}
+}
+
+func nextRun(t *testing.T, s *Scheduler, id string) time.Time {
+	t.Helper()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[id]
+	if !ok {
+		t.Fatalf("%s isn't scheduled", id)
+	}
+	return entry.nextRun
+}
+
+// between fails the test if got isn't in [from, to]. Intervals are rounded down to the second by
+// cron so from is moved back a second.
+func between(t *testing.T, got time.Time, from time.Time, to time.Time) {
+	t.Helper()
+	if got.Before(from.Add(-time.Second)) || got.After(to) {
+		t.Errorf("got %s, want between %s and %s", got, from, to)
+	}
+}
+
+func TestUpdateInvalidSchedule(t *testing.T) {
+	s := newTestScheduler(t, 0)
+	current := []playlists.Playlist{
+		{Name: "one", AppleMusicID: "p.one", Interval: time.Hour},
+		{Name: "two", AppleMusicID: "p.two", Interval: time.Hour},
+	}
+	err := s.Update(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mutex.Lock()
+	before := s.runs()
+	s.mutex.Unlock()
+
+	err = s.Update([]playlists.Playlist{
+		{Name: "one", AppleMusicID: "p.one", Interval: 2 * time.Hour},
+		{Name: "three", AppleMusicID: "p.three"},
+		{Name: "two", AppleMusicID: "p.two", Cron: "not a cron expression"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the invalid cron expression")
+	}
+
+	s.mutex.Lock()
+	after := s.runs()
+	s.mutex.Unlock()
+	if !maps.Equal(after, before) {
+		t.Errorf("runs changed from %+v to %+v", before, after)
+	}
+	s.mutex.Lock()
+	interval := s.entries["p.one"].playlist.Interval
+	s.mutex.Unlock()
+	if interval != time.Hour {
+		t.Errorf("interval of p.one changed to %s", interval)
+	}
+
+	saved, err := s.File.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved["p.three"]; ok || len(saved) != 2 {
+		t.Errorf("saved schedule changed: %+v", saved)
+	}
+}
+
+func TestUpdateChangedSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed playlists.Playlist
+		from    time.Duration
+		to      time.Duration
+	}{
+		{
+			name:    "interval",
+			changed: playlists.Playlist{AppleMusicID: "p.one", Interval: 2 * time.Hour},
+			from:    2 * time.Hour,
+			to:      2 * time.Hour,
+		},
+		{
+			name:    "cron",
+			changed: playlists.Playlist{AppleMusicID: "p.one", Cron: "0 * * * *"},
+			from:    0,
+			to:      time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestScheduler(t, 0)
+			err := s.Update([]playlists.Playlist{{AppleMusicID: "p.one"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the playlist has never been synced so it has no last run to schedule from
+			now := time.Now()
+			err = s.Update([]playlists.Playlist{test.changed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if due := s.Due(now); len(due) != 0 {
+				t.Errorf("got %d due playlists after the schedule changed, want 0", len(due))
+			}
+			between(t, nextRun(t, s, "p.one"), now.Add(test.from), time.Now().Add(test.to))
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const jitter = 10 * time.Minute
+	s := newTestScheduler(t, jitter)
+	current := []playlists.Playlist{}
+	for _, id := range []string{"p.one", "p.two", "p.three", "p.four", "p.five"} {
+		current = append(current, playlists.Playlist{AppleMusicID: id})
+	}
+
+	now := time.Now()
+	err := s.Update(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, playlist := range current {
+		between(t, nextRun(t, s, playlist.AppleMusicID), now, time.Now().Add(jitter))
+	}
+
+	due := s.Due(now.Add(jitter))
+	if len(due) != len(current) {
+		t.Fatalf("got %d due playlists, want %d", len(due), len(current))
+	}
+	for _, playlist := range due {
+		at := time.Now()
+		next, err := s.Finished(playlist.AppleMusicID, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		between(t, next, at.Add(time.Hour), at.Add(time.Hour+jitter))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	lastRun := now.Add(-30 * time.Minute)
+	saved := now.Add(30 * time.Minute)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+	}{
+		{name: "saved next run", interval: time.Hour, want: 30 * time.Minute},
+		{name: "shorter schedule", interval: 10 * time.Minute, want: 10 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestScheduler(t, 0)
+			err := s.File.Save(store.Schedule{
+				"p.one":     {Playlist: "one", LastRun: lastRun, NextRun: saved},
+				"p.removed": {Playlist: "removed", LastRun: lastRun, NextRun: saved},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Update([]playlists.Playlist{
+				{Name: "one", AppleMusicID: "p.one", Interval: test.interval},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if due := s.Due(time.Now()); len(due) != 0 {
+				t.Errorf("got %d due playlists right after restoring, want 0", len(due))
+			}
+			between(t, nextRun(t, s, "p.one"), now.Add(test.want), time.Now().Add(test.want))
+
+			runs := s.Upcoming()
+			if len(runs) != 1 {
+				t.Fatalf("got %d scheduled playlists, want 1", len(runs))
+			}
+			if !runs[0].LastRun.Equal(lastRun) {
+				t.Errorf("got last run %s, want %s", runs[0].LastRun, lastRun)
+			}
+		})
+	}
+}
+
+func TestDisable(t *testing.T) {
+	s := newTestScheduler(t, 0)
+	playlist := playlists.Playlist{Name: "one", AppleMusicID: "p.one", SpotifyID: "spotify"}
+	err := s.Update([]playlists.Playlist{playlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := s.Due(time.Now()); len(due) != 1 {
+		t.Fatalf("got %d due playlists, want 1", len(due))
+	}
+	err = s.Disable(playlist.AppleMusicID, "playlist not found")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Update([]playlists.Playlist{playlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := s.Due(time.Now()); len(due) != 0 {
+		t.Errorf("got %d due playlists after disabling, want 0", len(due))
+	}
+	if _, ok := s.NextRun(); ok {
+		t.Error("got a next run for a disabled playlist")
+	}
+	if runs := s.Upcoming(); len(runs) != 1 || runs[0].Disabled != "playlist not found" {
+		t.Errorf("disabled reason wasn't kept: %+v", runs)
+	}
+
+	playlist.SpotifyID = "new-spotify"
+	err = s.Update([]playlists.Playlist{playlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := s.Due(time.Now()); len(due) != 1 {
+		t.Errorf("got %d due playlists after the spotify id changed, want 1", len(due))
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditAction is the kind of change an audit entry records.
+type AuditAction string
+
+const (
+	AuditAdd             AuditAction = "add"
+	AuditRemove          AuditAction = "remove"
+	AuditAddToAppleMusic AuditAction = "add_to_apple_music"
+)
+
+// AuditEntry is a song that was added to or removed from a playlist. SnapshotID is the version of
+// the Spotify playlist that the change was made against.
+type AuditEntry struct {
+	Time         time.Time   `json:"time"`
+	Playlist     string      `json:"playlist"`
+	AppleMusicID string      `json:"apple_music"`
+	SpotifyID    string      `json:"spotify"`
+	Action       AuditAction `json:"action"`
+	Name         string      `json:"name"`
+	Artist       string      `json:"artist"`
+	ISRC         string      `json:"isrc"`
+	TrackID      string      `json:"track_id"`
+	Reason       string      `json:"reason"`
+	MatchedBy    string      `json:"matched_by,omitempty"`
+	SnapshotID   string      `json:"snapshot_id"`
+}
+
+// AuditLog is an append only log of every change made to playlists, stored as one JSON encoded
+// entry per line.
+type AuditLog struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Append adds the entries to the end of the log.
+func (l *AuditLog) Append(entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(l.Path), 0o755)
+	if err != nil {
+		return fmt.Errorf("%w failed to create directory for %s", err, l.Path)
+	}
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w failed to open %s", err, l.Path)
+	}
+
+	// entries are written in one go so a crash can't leave part of a sync in the log
+	lines := []byte{}
+	for _, entry := range entries {
+		binary, err := json.Marshal(entry)
+		if err != nil {
+			_ = file.Close()
+			return fmt.Errorf("%w failed to json marshal audit entry", err)
+		}
+		lines = append(append(lines, binary...), '\n')
+	}
+	_, err = file.Write(lines)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("%w failed to write to %s", err, l.Path)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("%w failed to close %s", err, l.Path)
+	}
+	return nil
+}
+
+// Entries reads the entries in the log, oldest first, that keep returns true for. If the log
+// doesn't exist yet no entries are returned.
+func (l *AuditLog) Entries(keep func(entry AuditEntry) bool) ([]AuditEntry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := os.Open(l.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return []AuditEntry{}, fmt.Errorf("%w failed to open %s", err, l.Path)
+	}
+	defer file.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return []AuditEntry{}, fmt.Errorf("%w failed to parse line %d of %s", err, line, l.Path)
+		}
+		if keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return []AuditEntry{}, fmt.Errorf("%w failed to read %s", err, l.Path)
+	}
+	return entries, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	log := &AuditLog{Path: filepath.Join(t.TempDir(), "data", "audit.jsonl")}
+	entries, err := log.Entries(func(AuditEntry) bool { return true })
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Entries() of a missing log = %v, %v, want none", entries, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	first := []AuditEntry{
+		{Time: now, Playlist: "chill", Action: AuditRemove, Name: "one", SnapshotID: "snapshot"},
+		{Time: now, Playlist: "chill", Action: AuditAdd, Name: "two", MatchedBy: "isrc"},
+	}
+	err = log.Append(first...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = log.Append()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := AuditEntry{Time: now.Add(time.Hour), Playlist: "rap", Action: AuditAddToAppleMusic}
+	err = log.Append(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = log.Entries(func(AuditEntry) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(first, second)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry != want[i] {
+			t.Errorf("entry #%d = %+v, want %+v", i+1, entry, want[i])
+		}
+	}
+
+	entries, err = log.Entries(func(entry AuditEntry) bool { return entry.Playlist == "rap" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0] != second {
+		t.Errorf("filtered entries = %+v, want only %+v", entries, second)
+	}
+}
+
+func TestAuditLogConcurrentAppends(t *testing.T) {
+	log := &AuditLog{Path: filepath.Join(t.TempDir(), "audit.jsonl")}
+	var wg sync.WaitGroup
+	for _, playlist := range []string{"one", "two", "three", "four"} {
+		wg.Go(func() {
+			for range 25 {
+				err := log.Append(
+					AuditEntry{Playlist: playlist, Action: AuditRemove},
+					AuditEntry{Playlist: playlist, Action: AuditAdd},
+				)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	entries, err := log.Entries(func(AuditEntry) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 200 {
+		t.Fatalf("got %d entries, want 200", len(entries))
+	}
+	// the entries of each append are never split up by another append
+	for i := 0; i < len(entries); i += 2 {
+		if entries[i].Playlist != entries[i+1].Playlist || entries[i].Action != AuditRemove {
+			t.Fatalf("entries %d and %d aren't from the same append: %+v %+v",
+				i+1, i+2, entries[i], entries[i+1])
+		}
+	}
+}
+
+func TestAuditLogInvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	err := os.WriteFile(path, []byte("{\"playlist\": \"chill\"}\n\nnot json\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &AuditLog{Path: path}
+	_, err = log.Entries(func(AuditEntry) bool { return true })
+	if err == nil {
+		t.Fatal("expected an error for the invalid line")
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a JSON encoded value of type T that is persisted to disk. Writes go to a temporary file
+// that is then renamed over the original so a crash mid-write never leaves a corrupted file
+// behind.
+type File[T any] struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Load reads the value from disk. If the file doesn't exist yet the zero value of T is returned.
+func (f *File[T]) Load() (T, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.load()
+}
+
+// Save writes the value to disk, replacing whatever was there before.
+func (f *File[T]) Save(value T) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.save(value)
+}
+
+// Update loads the value, passes it to fn, and saves the result if fn doesn't return an error. The
+// file is locked for the whole operation.
+func (f *File[T]) Update(fn func(value *T) error) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	value, err := f.load()
+	if err != nil {
+		return err
+	}
+	err = fn(&value)
+	if err != nil {
+		return err
+	}
+	return f.save(value)
+}
+
+func (f *File[T]) load() (T, error) {
+	var value T
+	binary, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return value, nil
+	}
+	if err != nil {
+		return value, fmt.Errorf("%w failed to read %s", err, f.Path)
+	}
+
+	err = json.Unmarshal(binary, &value)
+	if err != nil {
+		return value, fmt.Errorf("%w failed to parse %s", err, f.Path)
+	}
+	return value, nil
+}
+
+func (f *File[T]) save(value T) error {
+	binary, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w failed to json marshal value", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.Path), 0o755)
+	if err != nil {
+		return fmt.Errorf("%w failed to create directory for %s", err, f.Path)
+	}
+
+	tmp := f.Path + ".tmp"
+	err = os.WriteFile(tmp, binary, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w failed to write %s", err, tmp)
+	}
+	err = os.Rename(tmp, f.Path)
+	if err != nil {
+		return fmt.Errorf("%w failed to move %s to %s", err, tmp, f.Path)
+	}
+	return nil
+}
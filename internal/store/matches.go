@@ -0,0 +1,51 @@
+package store
+
+import (
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+// Matches caches the results of searching Spotify for Apple Music songs, keyed by MatchKey. Songs
+// that couldn't be found are cached too so they aren't searched for every sync.
+type Matches map[string]CachedMatch
+
+// CachedMatch is the result of searching Spotify for a song and when the search happened.
+type CachedMatch struct {
+	Match    spotify.Match `json:"match"`
+	CachedAt time.Time     `json:"cached_at"`
+}
+
+// MatchCache is a file of matches along with how long they stay fresh for. A TTL of 0 disables
+// caching of those matches.
+type MatchCache struct {
+	File *File[Matches]
+	// TTL is how long songs that were found are cached for.
+	TTL time.Duration
+	// NegativeTTL is how long songs that couldn't be found are cached for.
+	NegativeTTL time.Duration
+}
+
+// MatchKey is the key of an Apple Music song in the match cache. The ISRC is used when present,
+// falling back to the Apple Music catalog ID. Songs with neither aren't cached and get an empty
+// key.
+func MatchKey(song applemusic.Song) string {
+	switch {
+	case song.ISRC != "":
+		return "isrc:" + song.ISRC
+	case song.ID != "":
+		return "apple_music:" + song.ID
+	default:
+		return ""
+	}
+}
+
+// Fresh reports if the cached match can still be used at the given time.
+func (c MatchCache) Fresh(match CachedMatch, now time.Time) bool {
+	ttl := c.TTL
+	if !match.Match.Found {
+		ttl = c.NegativeTTL
+	}
+	return now.Before(match.CachedAt.Add(ttl))
+}
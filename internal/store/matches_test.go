@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/applemusic"
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+func TestFresh(t *testing.T) {
+	var (
+		now      = time.Now()
+		cache    = MatchCache{TTL: 30 * 24 * time.Hour, NegativeTTL: 24 * time.Hour}
+		found    = spotify.Match{Found: true}
+		notFound = spotify.Match{}
+	)
+	tests := []struct {
+		name  string
+		cache MatchCache
+		match CachedMatch
+		want  bool
+	}{
+		{
+			name:  "found",
+			cache: cache,
+			match: CachedMatch{Match: found, CachedAt: now.Add(-48 * time.Hour)},
+			want:  true,
+		},
+		{
+			name:  "found and expired",
+			cache: cache,
+			match: CachedMatch{Match: found, CachedAt: now.Add(-31 * 24 * time.Hour)},
+			want:  false,
+		},
+		{
+			name:  "not found",
+			cache: cache,
+			match: CachedMatch{Match: notFound, CachedAt: now.Add(-time.Hour)},
+			want:  true,
+		},
+		{
+			name:  "not found and expired",
+			cache: cache,
+			match: CachedMatch{Match: notFound, CachedAt: now.Add(-48 * time.Hour)},
+			want:  false,
+		},
+		{
+			name:  "caching disabled",
+			cache: MatchCache{},
+			match: CachedMatch{Match: found, CachedAt: now},
+			want:  false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.cache.Fresh(test.match, now); got != test.want {
+				t.Errorf("Fresh = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	tests := []struct {
+		song applemusic.Song
+		want string
+	}{
+		{applemusic.Song{ID: "1", ISRC: "USUM71703861"}, "isrc:USUM71703861"},
+		{applemusic.Song{ID: "1"}, "apple_music:1"},
+		{applemusic.Song{Name: "Song"}, ""},
+	}
+	for _, test := range tests {
+		if got := MatchKey(test.song); got != test.want {
+			t.Errorf("MatchKey(%+v) = %q, want %q", test.song, got, test.want)
+		}
+	}
+}
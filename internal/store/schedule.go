@@ -0,0 +1,16 @@
+package store
+
+import "time"
+
+// Schedule is when each playlist was last synced and when it is next due to be synced, keyed by
+// the Apple Music playlist ID.
+type Schedule map[string]ScheduledRun
+
+// ScheduledRun is the last and next sync of a playlist. Disabled is why the playlist isn't being
+// synced, if it has been disabled.
+type ScheduledRun struct {
+	Playlist string    `json:"playlist"`
+	LastRun  time.Time `json:"last_run"`
+	NextRun  time.Time `json:"next_run"`
+	Disabled string    `json:"disabled,omitempty"`
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"time"
+
+	"go.mattglei.ch/musicsync/internal/apis/spotify"
+)
+
+// MaxSnapshots is how many snapshots are kept for each playlist. The oldest are dropped first.
+const MaxSnapshots = 20
+
+// Snapshots are the versions of each Spotify playlist from right before musicsync changed it,
+// keyed by the Spotify playlist ID.
+type Snapshots map[string]PlaylistSnapshots
+
+// PlaylistSnapshots are the snapshots of a playlist from oldest to newest.
+type PlaylistSnapshots struct {
+	Playlist  string     `json:"playlist"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Snapshot is the songs in a Spotify playlist, in order, at the version with SnapshotID.
+type Snapshot struct {
+	TakenAt    time.Time      `json:"taken_at"`
+	SnapshotID string         `json:"snapshot_id"`
+	Songs      []spotify.Song `json:"songs"`
+}
+
+// Add records a snapshot of a playlist, dropping the oldest snapshots of the playlist if there are
+// more than MaxSnapshots.
+func (s *Snapshots) Add(spotifyID string, playlist string, snapshot Snapshot) {
+	if *s == nil {
+		*s = Snapshots{}
+	}
+	snapshots := (*s)[spotifyID]
+	snapshots.Playlist = playlist
+	snapshots.Snapshots = append(snapshots.Snapshots, snapshot)
+	if len(snapshots.Snapshots) > MaxSnapshots {
+		snapshots.Snapshots = snapshots.Snapshots[len(snapshots.Snapshots)-MaxSnapshots:]
+	}
+	(*s)[spotifyID] = snapshots
+}
+
+// At returns the newest snapshot taken at or before t.
+func (p PlaylistSnapshots) At(t time.Time) (Snapshot, bool) {
+	for i := len(p.Snapshots) - 1; i >= 0; i-- {
+		if !p.Snapshots[i].TakenAt.After(t) {
+			return p.Snapshots[i], true
+		}
+	}
+	return Snapshot{}, false
+}
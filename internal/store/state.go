@@ -0,0 +1,18 @@
+package store
+
+// State is the sync state of every playlist, keyed by the Apple Music playlist ID.
+type State map[string]PlaylistState
+
+// PlaylistState is what musicsync knew about a playlist after its last successful sync.
+type PlaylistState struct {
+	// Songs are the keys (see diff.StateKeys) of the songs that were in both playlists. They are
+	// only kept for bidirectional playlists and are nil until the first bidirectional sync.
+	Songs []string `json:"songs"`
+
+	// SnapshotID and AppleMusicVersion identify the versions of the Spotify and Apple Music
+	// playlists right after the last sync, and Settings is a fingerprint of the playlist settings
+	// and overrides it used. A playlist doesn't need to be synced again until one of them changes.
+	SnapshotID        string `json:"snapshot_id,omitempty"`
+	AppleMusicVersion string `json:"apple_music_version,omitempty"`
+	Settings          string `json:"settings,omitempty"`
+}
@@ -0,0 +1,26 @@
+package store
+
+import "time"
+
+// Unmatched are the songs that couldn't be found on Spotify at the last sync of each playlist,
+// keyed by the Apple Music playlist ID.
+type Unmatched map[string]PlaylistUnmatched
+
+// PlaylistUnmatched are the songs in a playlist that couldn't be found on Spotify, keyed by
+// MatchKey (or the normalized name and artist for songs without an ISRC or catalog ID).
+type PlaylistUnmatched struct {
+	Playlist string                   `json:"playlist"`
+	Songs    map[string]UnmatchedSong `json:"songs"`
+}
+
+// UnmatchedSong is an Apple Music song that couldn't be found on Spotify. The ISRC and Apple Music
+// catalog ID can be used to pin or exclude the song in the overrides file.
+type UnmatchedSong struct {
+	Name         string    `json:"name"`
+	Artist       string    `json:"artist"`
+	ISRC         string    `json:"isrc"`
+	AppleMusicID string    `json:"apple_music"`
+	Reason       string    `json:"reason"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}